@@ -23,6 +23,9 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"text/template"
+	"time"
 
 	"context"
 
@@ -60,6 +63,16 @@ var port = flag.String("port", "8090", "url")
 var team = flag.String("team", "test", "team name")
 var mail = flag.String("email", "hugot@test.net", "Bot mail")
 var pass = flag.String("pass", "hugot", "Bot pass")
+var amURL = flag.String("alertmanager-url", "", "URL users should use to reach the Alertmanager UI, by default it is learnt from webhooks")
+var actionKey = flag.String("action-key", "", "key for signing alert notification buttons, so they keep working across restarts")
+var signingSecret = flag.String("signing-secret", "", "Slack signing secret used to verify button callbacks, alert notifications only get buttons if it is set")
+var tmplDir = flag.String("templates", "", "directory of alert notification templates")
+var ackFile = flag.String("acks", "", "file to keep alert acknowledgements in")
+var renotify = flag.Duration("renotify", 0, "resend alert notifications that are not acknowledged in this time")
+var escalateAfter = flag.Duration("escalate-after", 0, "escalate pages that are not acknowledged in this time")
+var escalateUsers = flag.String("escalate-users", "", "comma separated users to message, in turn, about unacknowledged pages")
+var escalateChannel = flag.String("escalate-channel", "", "channel to post unacknowledged pages to, once all the users have been tried")
+var escalationState = flag.String("escalation-state", "", "file to keep escalations in progress in")
 
 func main() {
 	flag.Parse()
@@ -88,7 +101,46 @@ func main() {
 		BasePath: "/",
 		Schemes:  []string{"http"},
 	})
-	prometheus.Register(c, amc, nil)
+	var tmpls *template.Template
+	if *tmplDir != "" {
+		if tmpls, err = prometheus.LoadTemplates(*tmplDir); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	ph := prometheus.Register(c, amc, tmpls)
+	if *amURL != "" {
+		ph.SetExternalURL(*amURL)
+	}
+	aa := prometheus.ActionAuth{SigningSecret: *signingSecret}
+	if *actionKey != "" {
+		aa.Key = []byte(*actionKey)
+	}
+	if err := ph.SetActionAuth(aa); err != nil {
+		glog.Fatal(err)
+	}
+	if *tmplDir != "" {
+		go ph.WatchTemplates(ctx, *tmplDir, 10*time.Second)
+	}
+	at := prometheus.AckTracking{Renotify: *renotify}
+	if *ackFile != "" {
+		if at.Store, err = prometheus.NewFileAckStore(*ackFile); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	ph.SetAckTracking(at)
+	if *escalateAfter > 0 {
+		e := prometheus.Escalation{
+			After:     *escalateAfter,
+			Channel:   *escalateChannel,
+			StateFile: *escalationState,
+		}
+		if *escalateUsers != "" {
+			e.Users = strings.Split(*escalateUsers, ",")
+		}
+		if err := ph.SetEscalation(e); err != nil {
+			glog.Fatal(err)
+		}
+	}
 
 	u, _ := url.Parse("http://localhost:8090")
 	bot.SetURL(u)
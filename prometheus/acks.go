@@ -0,0 +1,341 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/handlers/command"
+)
+
+// Ack records who acknowledged an alert group, and when. Groups are
+// identified by the short ID shown on notifications.
+type Ack struct {
+	Group string    `json:"group"`
+	By    string    `json:"by"`
+	At    time.Time `json:"at"`
+}
+
+// AckStore stores alert group acknowledgements.
+type AckStore interface {
+	// SetAck records an acknowledgement, replacing any earlier one for
+	// the same group.
+	SetAck(a Ack) error
+	// GetAck returns the acknowledgement for the group, if there is one.
+	GetAck(group string) (Ack, bool, error)
+	// ClearAck removes any acknowledgement for the group.
+	ClearAck(group string) error
+}
+
+// memoryAckStore keeps acknowledgements in memory.
+type memoryAckStore struct {
+	sync.Mutex
+	acks map[string]Ack
+}
+
+// NewMemoryAckStore returns an AckStore that keeps acknowledgements in
+// memory, they are lost on restart.
+func NewMemoryAckStore() AckStore {
+	return &memoryAckStore{acks: map[string]Ack{}}
+}
+
+func (s *memoryAckStore) SetAck(a Ack) error {
+	s.Lock()
+	defer s.Unlock()
+	s.acks[a.Group] = a
+	return nil
+}
+
+func (s *memoryAckStore) GetAck(group string) (Ack, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	a, ok := s.acks[group]
+	return a, ok, nil
+}
+
+func (s *memoryAckStore) ClearAck(group string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.acks, group)
+	return nil
+}
+
+// fileAckStore keeps acknowledgements in a JSON file.
+type fileAckStore struct {
+	sync.Mutex
+	path string
+	acks map[string]Ack
+}
+
+// NewFileAckStore returns an AckStore that keeps acknowledgements in
+// the given JSON file, so that they survive a restart. The file is
+// created if it does not exist.
+func NewFileAckStore(path string) (AckStore, error) {
+	s := &fileAckStore{
+		path: path,
+		acks: map[string]Ack{},
+	}
+
+	bs, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bs, &s.acks); err != nil {
+		return nil, fmt.Errorf("could not read acks from %s, %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *fileAckStore) SetAck(a Ack) error {
+	s.Lock()
+	defer s.Unlock()
+	s.acks[a.Group] = a
+	return s.save()
+}
+
+func (s *fileAckStore) GetAck(group string) (Ack, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	a, ok := s.acks[group]
+	return a, ok, nil
+}
+
+func (s *fileAckStore) ClearAck(group string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.acks[group]; !ok {
+		return nil
+	}
+	delete(s.acks, group)
+	return s.save()
+}
+
+// save writes the acks to a temporary file, and renames it over the
+// old one, so that a crash never leaves a partial file.
+func (s *fileAckStore) save() error {
+	return writeJSONFile(s.path, s.acks)
+}
+
+// writeJSONFile atomically replaces the file at path with the JSON
+// encoding of v.
+func writeJSONFile(path string, v interface{}) error {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bs); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// AckTracking configures alert group acknowledgements.
+type AckTracking struct {
+	// Store is where acknowledgements are kept, it defaults to an in
+	// memory store.
+	Store AckStore
+	// Renotify, if set, resends a firing notification that has not been
+	// acknowledged this long after it was sent. Unacknowledged groups
+	// are checked once a minute.
+	Renotify time.Duration
+}
+
+// ackCheckInterval is how often unacknowledged groups are checked for
+// renotification and escalation.
+const ackCheckInterval = time.Minute
+
+// unacked is a firing notification waiting to be acknowledged.
+type unacked struct {
+	groupKey string
+	sent     time.Time
+	ms       []destMessage
+}
+
+// acks tracks acknowledgements, and the notifications waiting for one.
+type acks struct {
+	sync.Mutex
+	store    AckStore
+	renotify time.Duration
+	pending  map[string]*unacked
+}
+
+func newAcks() *acks {
+	return &acks{
+		store:   NewMemoryAckStore(),
+		pending: map[string]*unacked{},
+	}
+}
+
+// SetAckTracking sets where alert group acknowledgements are stored, and
+// whether unacknowledged notifications are resent.
+func (p *promH) SetAckTracking(at AckTracking) {
+	p.acks.Lock()
+	defer p.acks.Unlock()
+	p.acks.store = at.Store
+	if p.acks.store == nil {
+		p.acks.store = NewMemoryAckStore()
+	}
+	p.acks.renotify = at.Renotify
+	if at.Renotify <= 0 {
+		p.acks.pending = map[string]*unacked{}
+	}
+}
+
+func (a *acks) getStore() AckStore {
+	a.Lock()
+	defer a.Unlock()
+	return a.store
+}
+
+// ack records that user acknowledged the group.
+func (p *promH) ack(id, user string) (Ack, error) {
+	a := Ack{Group: id, By: user, At: time.Now()}
+	if err := p.acks.getStore().SetAck(a); err != nil {
+		return Ack{}, fmt.Errorf("could not store ack, %w", err)
+	}
+
+	p.acks.Lock()
+	delete(p.acks.pending, id)
+	p.acks.Unlock()
+
+	return a, nil
+}
+
+// ackFor returns the acknowledgement for the group, or nil if it has
+// not been acknowledged. An ack made before any of the group's alerts
+// started belongs to an earlier episode, and is ignored.
+func (p *promH) ackFor(d *tmplData) *Ack {
+	a, ok, err := p.acks.getStore().GetAck(d.ShortID)
+	if err != nil {
+		glog.Errorf("could not read ack for %s, %v", d.ShortID, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	if len(d.Alerts) == 0 {
+		return &a
+	}
+	for _, al := range d.Alerts {
+		if al.StartsAt.IsZero() || al.StartsAt.Before(a.At) {
+			return &a
+		}
+	}
+	return nil
+}
+
+// trackAck updates acknowledgement tracking after a notification has
+// been sent. Once a group resolves its ack is cleared, so that it must
+// be acknowledged again if it fires again.
+func (p *promH) trackAck(groupKey string, d *tmplData, sent []destMessage) {
+	if d.Status == "resolved" {
+		if err := p.acks.getStore().ClearAck(d.ShortID); err != nil {
+			glog.Errorf("could not clear ack for %s, %v", d.ShortID, err)
+		}
+		p.acks.Lock()
+		delete(p.acks.pending, d.ShortID)
+		p.acks.Unlock()
+		return
+	}
+
+	p.acks.Lock()
+	defer p.acks.Unlock()
+	if p.acks.renotify <= 0 || d.Ack != nil || len(sent) == 0 {
+		return
+	}
+	p.acks.pending[d.ShortID] = &unacked{
+		groupKey: groupKey,
+		sent:     time.Now(),
+		ms:       sent,
+	}
+}
+
+// dueRenotify returns the notifications that have waited too long for
+// an acknowledgement, and marks them as sent again.
+func (p *promH) dueRenotify(now time.Time) []*unacked {
+	p.acks.Lock()
+	defer p.acks.Unlock()
+
+	due := []*unacked{}
+	for id, u := range p.acks.pending {
+		if now.Sub(u.sent) < p.acks.renotify {
+			continue
+		}
+		if _, ok, _ := p.acks.store.GetAck(id); ok {
+			delete(p.acks.pending, id)
+			continue
+		}
+		if _, ok := p.groups.get(id); !ok {
+			delete(p.acks.pending, id)
+			continue
+		}
+		u.sent = now
+		due = append(due, u)
+	}
+	return due
+}
+
+// sendRenotify resends firing notifications that have not been
+// acknowledged.
+func (p *promH) sendRenotify(ctx context.Context, w hugot.ResponseWriter) {
+	for _, u := range p.dueRenotify(time.Now()) {
+		for _, dm := range u.ms {
+			p.sendThreaded(ctx, w, u.groupKey, "firing", dm.dest, dm.m)
+		}
+	}
+}
+
+func (p *promH) ackCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "ack",
+		Short:   "acknowledge an alert group from a recent notification",
+		Example: "prometheus ack 3fa9c1",
+	}
+
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("you need to give a group ID")
+		}
+
+		g, ok := p.groups.get(args[0])
+		labels := g.GroupLabels
+		if !ok {
+			// Groups being escalated are remembered across restarts.
+			if labels, ok = p.escalatingGroup(args[0]); !ok {
+				return fmt.Errorf("unknown alert group %q, it may be too old", args[0])
+			}
+		}
+
+		if _, err := p.ack(args[0], m.From); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Acknowledged %s", strings.Join(labels.Values(), " "))
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
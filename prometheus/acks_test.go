@@ -0,0 +1,90 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileAckStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "acks.json")
+
+	s, err := NewFileAckStore(fn)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	at := time.Date(2020, 5, 1, 10, 5, 0, 0, time.UTC)
+	if err := s.SetAck(Ack{Group: "3fa9c1", By: "bob", At: at}); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if err := s.SetAck(Ack{Group: "000000", By: "alice", At: at}); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if err := s.ClearAck("000000"); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	s, err = NewFileAckStore(fn)
+	if err != nil {
+		t.Fatalf("unexpected error reloading, %v", err)
+	}
+	a, ok, err := s.GetAck("3fa9c1")
+	if err != nil || !ok {
+		t.Fatalf("expected the ack to survive a reload, got %v %v", ok, err)
+	}
+	if a.By != "bob" || !a.At.Equal(at) {
+		t.Fatalf("expected ack by bob at %v, got %#v", at, a)
+	}
+	if _, ok, _ := s.GetAck("000000"); ok {
+		t.Fatalf("expected the cleared ack to stay cleared")
+	}
+}
+
+func TestAckTracking(t *testing.T) {
+	p := newTestHandler()
+	p.SetAckTracking(AckTracking{Renotify: 10 * time.Minute})
+
+	d := &tmplData{
+		Status:      "firing",
+		GroupLabels: KV{"alertname": "TestAlert"},
+		Alerts:      alerts{{StartsAt: time.Now().Add(-time.Hour)}},
+	}
+	d.ShortID = p.groups.add(d)
+	sent := []destMessage{{dest: destination{Channel: "alerts"}, data: d}}
+
+	p.trackAck("{}", d, sent)
+	if due := p.dueRenotify(time.Now()); len(due) != 0 {
+		t.Fatalf("expected nothing due yet, got %d", len(due))
+	}
+	if due := p.dueRenotify(time.Now().Add(11 * time.Minute)); len(due) != 1 {
+		t.Fatalf("expected the unacked group to be due, got %d", len(due))
+	}
+
+	if _, err := p.ack(d.ShortID, "bob"); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if a := p.ackFor(d); a == nil || a.By != "bob" {
+		t.Fatalf("expected ack by bob, got %v", a)
+	}
+	if due := p.dueRenotify(time.Now().Add(time.Hour)); len(due) != 0 {
+		t.Fatalf("expected nothing due once acked, got %d", len(due))
+	}
+
+	refired := &tmplData{ShortID: d.ShortID, Alerts: alerts{{StartsAt: time.Now().Add(time.Minute)}}}
+	if a := p.ackFor(refired); a != nil {
+		t.Fatalf("expected an ack from before the alerts started to be ignored, got %v", a)
+	}
+
+	d.Status = "resolved"
+	p.trackAck("{}", d, sent)
+	if a := p.ackFor(d); a != nil {
+		t.Fatalf("expected the ack to be cleared on resolve, got %v", a)
+	}
+}
@@ -0,0 +1,402 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// ActionAuth configures how the callbacks from the buttons on alert
+// notifications are verified.
+type ActionAuth struct {
+	// Key signs the value of each button, so that only buttons posted
+	// by the handler are acted on. By default a random key is used, and
+	// buttons stop working when the handler restarts. It must be at
+	// least 16 bytes.
+	Key []byte
+	// SigningSecret is the Slack app signing secret used to verify that
+	// callbacks came from Slack, and so who pressed the button. Without
+	// it, buttons are not added to notifications and callbacks are
+	// refused.
+	SigningSecret string
+}
+
+// maxActionAge is how old a signed Slack callback may be.
+const maxActionAge = 5 * time.Minute
+
+// maxButtonAge is how long after a notification is sent its buttons
+// keep working. It matches Alertmanager's default repeat_interval, so
+// groups that are still firing get fresh buttons before the old ones
+// stop working.
+const maxButtonAge = 4 * time.Hour
+
+// actionCallbackID is the callback ID of the attachments we add buttons
+// to.
+const actionCallbackID = "prometheus_alert"
+
+// alertAction is something that can be done to an alert group from
+// its notification.
+type alertAction struct {
+	id      string
+	name    string
+	style   string
+	command string
+	do      func(ctx context.Context, p *promH, rw hugot.ResponseWriter, id string, g recentGroup, dest destination, user string) (string, error)
+}
+
+var alertActions = []alertAction{
+	{
+		id:      "silence1h",
+		name:    "Silence 1h",
+		command: "prometheus silence-group %s 1h",
+		do:      silenceAction(1 * time.Hour),
+	},
+	{
+		id:      "silence4h",
+		name:    "Silence 4h",
+		command: "prometheus silence-group %s 4h",
+		do:      silenceAction(4 * time.Hour),
+	},
+	{
+		id:      "ack",
+		name:    "Ack",
+		style:   "primary",
+		command: "prometheus ack %s",
+		do:      ackAction,
+	},
+	{
+		id:      "graph",
+		name:    "Show graph",
+		command: "prometheus graph-group %s",
+		do:      graphAction,
+	},
+}
+
+func silenceAction(dur time.Duration) func(context.Context, *promH, hugot.ResponseWriter, string, recentGroup, destination, string) (string, error) {
+	return func(ctx context.Context, p *promH, rw hugot.ResponseWriter, id string, g recentGroup, dest destination, user string) (string, error) {
+		if len(g.GroupLabels) == 0 {
+			return "", fmt.Errorf("alert group %s has no group labels to silence", id)
+		}
+		sid, err := p.createSilence(ctx, groupMatchers(g.GroupLabels), user, fmt.Sprintf("silenced alert group %s from chat", id), dur)
+		if err != nil {
+			return "", err
+		}
+		msg := fmt.Sprintf("%s silenced %s for %s, silence %s", user, strings.Join(g.GroupLabels.Values(), " "), dur, sid)
+		if u := p.silenceURL(sid); u != "" {
+			msg += fmt.Sprintf(" (%s)", u)
+		}
+		return msg, nil
+	}
+}
+
+func ackAction(ctx context.Context, p *promH, rw hugot.ResponseWriter, id string, g recentGroup, dest destination, user string) (string, error) {
+	if _, err := p.ack(id, user); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s acknowledged %s", user, strings.Join(g.GroupLabels.Values(), " ")), nil
+}
+
+func graphAction(ctx context.Context, p *promH, rw hugot.ResponseWriter, id string, g recentGroup, dest destination, user string) (string, error) {
+	m := p.groupGraphs(g)
+	if m == nil {
+		return "", fmt.Errorf("alert group %s has no expression to graph", id)
+	}
+	dm := dest.message()
+	dm.Attachments = m.Attachments
+	rw.Send(ctx, dm)
+	return "", nil
+}
+
+// groupGraphs returns a message with graphs of the expressions of the
+// alerts in the group, or nil if there are none.
+func (p *promH) groupGraphs(g recentGroup) *hugot.Message {
+	if len(g.Exprs) == 0 {
+		return nil
+	}
+	start := g.StartsAt.Add(-15 * time.Minute)
+	if g.StartsAt.IsZero() {
+		start = time.Now().Add(-1 * time.Hour)
+	}
+	m := &hugot.Message{}
+	for _, expr := range g.Exprs {
+		m.Attachments = append(m.Attachments, hugot.Attachment{
+			Fallback: expr,
+			Title:    expr,
+			ImageURL: p.graphURL(expr, start, time.Now()),
+		})
+	}
+	return m
+}
+
+// newActionKey returns a random key for signing button values.
+func newActionKey() []byte {
+	k := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, k); err != nil {
+		panic(fmt.Sprintf("could not generate action key, %v", err))
+	}
+	return k
+}
+
+// SetActionAuth sets how callbacks from notification buttons are
+// verified.
+func (p *promH) SetActionAuth(aa ActionAuth) error {
+	if aa.Key == nil {
+		aa.Key = newActionKey()
+	}
+	if len(aa.Key) < 16 {
+		return fmt.Errorf("the action key must be at least 16 bytes")
+	}
+	if aa.SigningSecret == "" {
+		glog.Warningf("no signing secret is set, alert notifications will not have buttons and action callbacks will be refused")
+	}
+
+	p.actionMu.Lock()
+	defer p.actionMu.Unlock()
+	p.actionAuth = aa
+	return nil
+}
+
+func (p *promH) getActionAuth() ActionAuth {
+	p.actionMu.RLock()
+	defer p.actionMu.RUnlock()
+	return p.actionAuth
+}
+
+func (p *promH) actionSig(action, id, dest, issued string) string {
+	mac := hmac.New(sha256.New, p.getActionAuth().Key)
+	io.WriteString(mac, action+"\xff"+id+"\xff"+dest+"\xff"+issued)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// actionValue returns the signed button value for an action on a
+// group, to be sent to a destination. The value includes when it was
+// issued, so that it stops working after maxButtonAge.
+func (p *promH) actionValue(action, id string, dest destination, issued time.Time) string {
+	t := strconv.FormatInt(issued.Unix(), 10)
+	qs := url.Values{}
+	qs.Set("a", action)
+	qs.Set("g", id)
+	qs.Set("d", dest.key())
+	qs.Set("t", t)
+	qs.Set("s", p.actionSig(action, id, dest.key(), t))
+	return qs.Encode()
+}
+
+// checkActionValue verifies the signature and age of a button value.
+func (p *promH) checkActionValue(qs url.Values, now time.Time) error {
+	a, id, dk, t := qs.Get("a"), qs.Get("g"), qs.Get("d"), qs.Get("t")
+	if !hmac.Equal([]byte(qs.Get("s")), []byte(p.actionSig(a, id, dk, t))) {
+		return fmt.Errorf("bad action signature")
+	}
+	secs, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad action issue time %q", t)
+	}
+	if d := now.Sub(time.Unix(secs, 0)); d > maxButtonAge || d < -maxActionAge {
+		return fmt.Errorf("the button has expired, use the command in the notification instead")
+	}
+	return nil
+}
+
+// addActions adds buttons for the alert actions to the first attachment
+// of a firing notification. The equivalent commands are added to the
+// attachment's fallback, and to plain text notifications, for chat
+// clients that cannot show buttons. Buttons are only added if there is
+// a signing secret to verify their callbacks.
+func (p *promH) addActions(dest destination, d *tmplData, m *hugot.Message) {
+	if d.Status != "firing" || d.ShortID == "" {
+		return
+	}
+
+	cmds := []string{}
+	for _, a := range alertActions {
+		cmds = append(cmds, fmt.Sprintf("%s: %s", a.name, fmt.Sprintf(a.command, d.ShortID)))
+	}
+	fallback := strings.Join(cmds, " | ")
+
+	if len(m.Attachments) == 0 {
+		m.Text = strings.TrimRight(m.Text, "\n") + "\n" + fallback
+		return
+	}
+
+	atch := &m.Attachments[0]
+	atch.Fallback = strings.TrimRight(atch.Fallback, "\n") + "\n" + fallback
+	if p.getActionAuth().SigningSecret == "" {
+		return
+	}
+
+	now := time.Now()
+	atch.CallbackID = actionCallbackID
+	atch.Actions = nil
+	for _, a := range alertActions {
+		atch.Actions = append(atch.Actions, hugot.AttachmentAction{
+			Name:  a.id,
+			Text:  a.name,
+			Type:  "button",
+			Style: a.style,
+			Value: p.actionValue(a.id, d.ShortID, dest, now),
+		})
+	}
+}
+
+// actionPayload is the part of a Slack interactive message callback
+// that we use.
+type actionPayload struct {
+	CallbackID string `json:"callback_id"`
+	Actions    []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"actions"`
+	User struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+// checkSlackSignature verifies the Slack request signature on a
+// callback body.
+func checkSlackSignature(secret string, r *http.Request, body []byte, now time.Time) error {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad request timestamp %q", ts)
+	}
+	if d := now.Sub(time.Unix(secs, 0)); d > maxActionAge || d < -maxActionAge {
+		return fmt.Errorf("request timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, "v0:"+ts+":")
+	mac.Write(body)
+	exp := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(r.Header.Get("X-Slack-Signature")), []byte(exp)) {
+		return fmt.Errorf("bad request signature")
+	}
+	return nil
+}
+
+// actionError logs a failed action callback, and replies with a short
+// JSON error.
+func actionError(w http.ResponseWriter, code int, err error) {
+	glog.Errorf("alert action callback failed, %v", err)
+	writeJSONError(w, code, err)
+}
+
+// actionsHook handles the callbacks from alert notification buttons.
+// These are Slack interactive message callbacks, a form with the JSON
+// payload in the payload field.
+func (p *promH) actionsHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		actionError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		actionError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	secret := p.getActionAuth().SigningSecret
+	if secret == "" {
+		actionError(w, http.StatusForbidden, fmt.Errorf("no signing secret is set to verify callbacks"))
+		return
+	}
+	if err := checkSlackSignature(secret, r, body, time.Now()); err != nil {
+		actionError(w, http.StatusForbidden, err)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("bad callback form, %w", err))
+		return
+	}
+	var pl actionPayload
+	if err := json.Unmarshal([]byte(form.Get("payload")), &pl); err != nil {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("bad callback payload, %w", err))
+		return
+	}
+	if pl.CallbackID != actionCallbackID || len(pl.Actions) == 0 {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("callback is not for an alert action"))
+		return
+	}
+
+	user := pl.User.Name
+	if user == "" {
+		user = pl.User.ID
+	}
+	if user == "" {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("callback does not say who pressed the button"))
+		return
+	}
+
+	qs, err := url.ParseQuery(pl.Actions[0].Value)
+	if err != nil {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("bad action value, %w", err))
+		return
+	}
+	if err := p.checkActionValue(qs, time.Now()); err != nil {
+		actionError(w, http.StatusForbidden, err)
+		return
+	}
+	a, id, dk := qs.Get("a"), qs.Get("g"), qs.Get("d")
+
+	var action *alertAction
+	for i := range alertActions {
+		if alertActions[i].id == a {
+			action = &alertActions[i]
+		}
+	}
+	if action == nil {
+		actionError(w, http.StatusBadRequest, fmt.Errorf("unknown action %q", a))
+		return
+	}
+
+	g, ok := p.groups.get(id)
+	if !ok {
+		actionError(w, http.StatusNotFound, fmt.Errorf("unknown alert group %q, it may be too old", id))
+		return
+	}
+
+	rw, ok := hugot.ResponseWriterFromContext(r.Context())
+	if !ok {
+		actionError(w, http.StatusInternalServerError, fmt.Errorf("no chat connection available"))
+		return
+	}
+
+	dest := destination{Channel: dk}
+	if strings.HasPrefix(dk, "@") {
+		dest = destination{User: strings.TrimPrefix(dk, "@")}
+	}
+
+	msg, err := action.do(r.Context(), p, rw, id, g, dest, user)
+	if err != nil {
+		actionError(w, http.StatusInternalServerError, fmt.Errorf("%s failed, %w", action.name, err))
+		return
+	}
+
+	if msg != "" {
+		m := dest.message()
+		m.Text = msg
+		rw.Send(r.Context(), m)
+	}
+	glog.Infof("%s: %s for alert group %s", user, action.name, id)
+
+	// An empty 200 leaves the original message as it was.
+	w.WriteHeader(http.StatusOK)
+}
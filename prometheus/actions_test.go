@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tcolgate/hugot"
+)
+
+const testActionSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+func newActionTestHandler(t *testing.T) *promH {
+	p := newTestHandler()
+	err := p.SetActionAuth(ActionAuth{
+		Key:           []byte("0123456789abcdef0123456789abcdef"),
+		SigningSecret: testActionSecret,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	return p
+}
+
+// actionRequest builds a signed Slack interactive message callback.
+func actionRequest(secret string, ts time.Time, callbackID, user, value string) *http.Request {
+	pl := map[string]interface{}{
+		"callback_id": callbackID,
+		"actions":     []map[string]string{{"name": "ack", "value": value}},
+		"user":        map[string]string{"id": "U123", "name": user},
+	}
+	if user == "" {
+		delete(pl, "user")
+	}
+	js, _ := json.Marshal(pl)
+	body := url.Values{"payload": {string(js)}}.Encode()
+
+	r := httptest.NewRequest("POST", "/actions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	sts := fmt.Sprintf("%d", ts.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + sts + ":" + body))
+	r.Header.Set("X-Slack-Request-Timestamp", sts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestActionButtons(t *testing.T) {
+	p := newActionTestHandler(t)
+
+	fw := newFakeWriter()
+	r := httptest.NewRequest("POST", "/alerts", strings.NewReader(testHookBody))
+	r = r.WithContext(hugot.NewResponseWriterContext(r.Context(), fw))
+	w := httptest.NewRecorder()
+	p.alertsHook(w, r)
+	if w.Code != http.StatusOK || len(fw.sent) != 1 {
+		t.Fatalf("expected a notification, got status %d and %d messages", w.Code, len(fw.sent))
+	}
+
+	atch := fw.sent[0].Attachments[0]
+	if atch.CallbackID != actionCallbackID || len(atch.Actions) != len(alertActions) {
+		t.Fatalf("expected %d buttons, got %#v", len(alertActions), atch)
+	}
+	id := groupID("hugot", KV{"alertname": "TestAlert"})
+	if !strings.Contains(atch.Fallback, "prometheus ack "+id) {
+		t.Errorf("expected the commands in the fallback, got %q", atch.Fallback)
+	}
+	var ack string
+	for _, a := range atch.Actions {
+		if a.Name == "ack" {
+			ack = a.Value
+		}
+	}
+	if ack == "" {
+		t.Fatalf("expected an ack button, got %#v", atch.Actions)
+	}
+
+	// A handler restarted with the same key accepts the old buttons.
+	qs, _ := url.ParseQuery(ack)
+	secs, err := strconv.ParseInt(qs.Get("t"), 10, 64)
+	if err != nil {
+		t.Fatalf("expected an issue time in the button value, got %q", ack)
+	}
+	p2 := newActionTestHandler(t)
+	if v := p2.actionValue("ack", id, destination{Channel: "alerts"}, time.Unix(secs, 0)); v != ack {
+		t.Errorf("expected the same key to give the same button value")
+	}
+
+	tampered := strings.Replace(ack, "a=ack", "a=silence4h", 1)
+	now := time.Now()
+	expired := p.actionValue("ack", id, destination{Channel: "alerts"}, now.Add(-maxButtonAge-time.Minute))
+	retimed := strings.Replace(ack, "t="+qs.Get("t"), fmt.Sprintf("t=%d", now.Add(time.Hour).Unix()), 1)
+	tests := []struct {
+		name string
+		r    *http.Request
+		exp  int
+	}{
+		{name: "bad slack signature", r: actionRequest("wrong", now, actionCallbackID, "bob", ack), exp: http.StatusForbidden},
+		{name: "old request", r: actionRequest(testActionSecret, now.Add(-time.Hour), actionCallbackID, "bob", ack), exp: http.StatusForbidden},
+		{name: "other callback", r: actionRequest(testActionSecret, now, "other", "bob", ack), exp: http.StatusBadRequest},
+		{name: "no user", r: actionRequest(testActionSecret, now, actionCallbackID, "", ack), exp: http.StatusBadRequest},
+		{name: "tampered value", r: actionRequest(testActionSecret, now, actionCallbackID, "bob", tampered), exp: http.StatusForbidden},
+		{name: "tampered issue time", r: actionRequest(testActionSecret, now, actionCallbackID, "bob", retimed), exp: http.StatusForbidden},
+		{name: "expired button", r: actionRequest(testActionSecret, now, actionCallbackID, "bob", expired), exp: http.StatusForbidden},
+		{name: "no chat connection", r: actionRequest(testActionSecret, now, actionCallbackID, "bob", ack), exp: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		p.actionsHook(w, tt.r)
+		if w.Code != tt.exp {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.exp, w.Code)
+		}
+	}
+
+	fw = newFakeWriter()
+	r = actionRequest(testActionSecret, now, actionCallbackID, "bob", ack)
+	r = r.WithContext(hugot.NewResponseWriterContext(r.Context(), fw))
+	w = httptest.NewRecorder()
+	p.actionsHook(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, %s", w.Code, w.Body.String())
+	}
+	if a, ok, _ := p.acks.getStore().GetAck(id); !ok || a.By != "bob" {
+		t.Errorf("expected the group to be acked by bob, got %#v", a)
+	}
+	if len(fw.sent) != 1 || fw.sent[0].Channel != "alerts" || fw.sent[0].Text != "bob acknowledged TestAlert" {
+		t.Errorf("expected the ack to be reported in alerts, got %v", fw.sent)
+	}
+}
+
+func TestAddActionsFallback(t *testing.T) {
+	p := newActionTestHandler(t)
+
+	m := &hugot.Message{Text: "[FIRING] DiskFull"}
+	p.addActions(destination{Channel: "alerts"}, &tmplData{Status: "firing", ShortID: "3fa9c1"}, m)
+	if !strings.Contains(m.Text, "prometheus silence-group 3fa9c1 1h") {
+		t.Errorf("expected the silence command in plain text, got %q", m.Text)
+	}
+
+	m = &hugot.Message{Attachments: []hugot.Attachment{{Fallback: "resolved"}}}
+	p.addActions(destination{Channel: "alerts"}, &tmplData{Status: "resolved", ShortID: "3fa9c1"}, m)
+	if m.Attachments[0].Fallback != "resolved" || len(m.Attachments[0].Actions) != 0 {
+		t.Errorf("expected resolved notifications to be left alone, got %#v", m.Attachments[0])
+	}
+
+	if err := p.SetActionAuth(ActionAuth{Key: []byte("short")}); err == nil {
+		t.Errorf("expected an error for a short key")
+	}
+}
+
+func TestActionsNeedSigningSecret(t *testing.T) {
+	p := newTestHandler()
+	if err := p.SetActionAuth(ActionAuth{}); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	m := &hugot.Message{Attachments: []hugot.Attachment{{Fallback: "[FIRING:1] DiskFull"}}}
+	p.addActions(destination{Channel: "alerts"}, &tmplData{Status: "firing", ShortID: "3fa9c1"}, m)
+	atch := m.Attachments[0]
+	if len(atch.Actions) != 0 || atch.CallbackID != "" {
+		t.Errorf("expected no buttons without a signing secret, got %#v", atch)
+	}
+	if !strings.Contains(atch.Fallback, "prometheus ack 3fa9c1") {
+		t.Errorf("expected the commands in the fallback, got %q", atch.Fallback)
+	}
+
+	// Anyone could send a callback, so they are refused.
+	value := p.actionValue("ack", "3fa9c1", destination{Channel: "alerts"}, time.Now())
+	r := actionRequest("", time.Now(), actionCallbackID, "bob", value)
+	r = r.WithContext(hugot.NewResponseWriterContext(r.Context(), newFakeWriter()))
+	w := httptest.NewRecorder()
+	p.actionsHook(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", w.Code)
+	}
+}
@@ -5,145 +5,446 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
+	"unicode"
 
+	"github.com/go-openapi/strfmt"
 	"github.com/golang/glog"
-	"github.com/prometheus/alertmanager/api/v2/client"
+	amalert "github.com/prometheus/alertmanager/api/v2/client/alert"
 	"github.com/prometheus/alertmanager/api/v2/client/alertgroup"
-	"github.com/prometheus/alertmanager/api/v2/client/silence"
 	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/alertmanager/notify/webhook"
+	amT "github.com/prometheus/alertmanager/template"
 	model "github.com/prometheus/common/model"
 	"github.com/tcolgate/hugot"
 	"github.com/tcolgate/hugot/handlers/command"
 )
 
+// maxFullGroups is the number of alert groups above which the alerts
+// command sends a summary, unless --full is given.
+const maxFullGroups = 5
+
+// alertGroupsParams builds the Alertmanager query for the alerts
+// command's flags. An empty receiver matches all receivers.
+func alertGroupsParams(ctx context.Context, filter []string, receiver string, silenced, inhibited, active bool) (*alertgroup.GetAlertGroupsParams, error) {
+	if _, err := parseMatchers(filter); err != nil {
+		return nil, err
+	}
+
+	params := &alertgroup.GetAlertGroupsParams{
+		Context:   ctx,
+		Filter:    filter,
+		Silenced:  &silenced,
+		Inhibited: &inhibited,
+		Active:    &active,
+	}
+	if receiver != "" {
+		params.Receiver = &receiver
+	}
+	return params, nil
+}
+
 func (p *promH) alertCmd(root *command.Command) {
-	root.AddCommand(&command.Command{
+	cmd := &command.Command{
 		Use:   "alerts",
 		Short: "manage alertmanager alerts",
-		Run: func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
-			resp, err := p.amclient.Alertgroup.GetAlertGroups(
-				&alertgroup.GetAlertGroupsParams{
-					Context: ctx,
-				})
-			if err != nil {
-				return err
-			}
-
-			ags := resp.GetPayload()
+	}
 
-			if len(ags) == 0 {
-				fmt.Fprint(w, "There are no outstanding alerts")
-				return nil
-			}
+	filter := cmd.Flags().StringArrayP("filter", "f", nil, "only show alerts matching these matchers")
+	receiver := cmd.Flags().StringP("receiver", "r", "", "only show alerts for receivers matching this regex")
+	silenced := cmd.Flags().Bool("silenced", false, "include silenced alerts")
+	inhibited := cmd.Flags().Bool("inhibited", false, "include inhibited alerts")
+	active := cmd.Flags().Bool("active", true, "include active alerts")
+	summary := cmd.Flags().Bool("summary", false, "send a single summary message, rather than one per group")
+	full := cmd.Flags().Bool("full", false, "send one message per group, even if there are many groups")
+	top := cmd.Flags().Int("top", 5, "how many of the largest groups to list in the summary")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if *summary && *full {
+			return fmt.Errorf("you can only give one of --summary and --full")
+		}
+		params, err := alertGroupsParams(ctx, *filter, *receiver, *silenced, *inhibited, *active)
+		if err != nil {
+			return err
+		}
 
-			for _, ag := range ags {
-				ls := ag.Labels
-				as := modelToLocal(ag.Alerts)
-				active := []alert{}
-				for _, a := range as {
-					if a.Resolved() {
-						continue
-					}
-
-					if a.Inhibited {
-						continue
-					}
-
-					if len(a.Silenced) != 0 {
-						continue
-					}
-					active = append(active, a)
-				}
+		resp, err := p.amclient.Alertgroup.GetAlertGroups(params)
+		if err != nil {
+			return err
+		}
 
-				if len(active) == 0 {
+		ds := []*tmplData{}
+		for _, ag := range resp.GetPayload() {
+			ls := ag.Labels
+			as := modelToLocal(ag.Alerts)
+			current := []alert{}
+			for _, a := range as {
+				if a.Resolved() {
 					continue
 				}
+				current = append(current, a)
+			}
 
-				d := data(p.amclient, *ag.Receiver.Name, ls, active)
-				rm, err := p.alertMessage(d)
-				if err != nil {
-					fmt.Fprintf(w, "error rendering template, %v", err)
-					continue
-				}
+			if len(current) == 0 {
+				continue
+			}
+
+			d := data(p.getExternalURL(), *ag.Receiver.Name, ls, current)
+			d.ShortID = p.groups.add(d)
+			d.Ack = p.ackFor(d)
+			ds = append(ds, d)
+		}
 
-				rm.Channel = m.Channel
-				rm.To = m.From
-				w.Send(ctx, rm)
+		if len(ds) == 0 {
+			fmt.Fprint(w, "There are no outstanding alerts")
+			return nil
+		}
+
+		if wantSummary(*summary, *full, len(ds)) {
+			var out bytes.Buffer
+			if err := p.templates().ExecuteTemplate(&out, "summary", p.summarize(ds, *top)); err != nil {
+				return fmt.Errorf("error rendering template, %w", err)
 			}
+			fmt.Fprint(w, out.String())
 			return nil
-		},
-	})
-}
+		}
 
-func (p *promH) silenceCmd(root *command.Command) {
-	root.AddCommand(&command.Command{
-		Use:   "silences",
-		Short: "manage alertmanager silences",
-		Run: func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
-			res, err := p.amclient.Silence.GetSilences(&silence.GetSilencesParams{Context: ctx})
+		for _, d := range ds {
+			rm, err := p.alertMessage(d)
 			if err != nil {
-				return err
+				fmt.Fprintf(w, "error rendering template, %v", err)
+				continue
 			}
-			ss := res.GetPayload()
 
-			if len(ss) == 0 {
-				fmt.Fprint(w, "There are no active silences")
-				return nil
+			dest := destination{Channel: m.Channel}
+			if m.Private {
+				dest = destination{User: m.From}
 			}
+			p.addActions(dest, d, rm)
+
+			rm.Channel = m.Channel
+			rm.To = m.From
+			w.Send(ctx, rm)
+		}
+		return nil
+	}
+
+	p.alertShowCmd(cmd)
+	p.alertFireCmd(cmd)
+
+	root.AddCommand(cmd)
+}
+
+// wantSummary reports whether the alerts command should send a summary
+// for n groups, rather than one message per group.
+func wantSummary(summary, full bool, n int) bool {
+	return summary || (!full && n > maxFullGroups)
+}
+
+// maxShownAlerts limits how many alerts alerts show will describe.
+const maxShownAlerts = 5
+
+func (p *promH) alertShowCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "show",
+		Short:   "show the details of an alert, by fingerprint or alertname",
+		Example: "prometheus alerts show 3ba2e0ad2bcf0e41\nprometheus alerts show InstanceDown",
+	}
+
+	graph := cmd.Flags().BoolP("graph", "g", true, "include a graph of the alert expression")
+	before := cmd.Flags().DurationP("before", "b", 15*time.Minute, "how far before the alert started to graph")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("you need to give an alert fingerprint, or alertname")
+		}
+
+		resp, err := p.amclient.Alert.GetAlerts(&amalert.GetAlertsParams{Context: ctx})
+		if err != nil {
+			return err
+		}
 
-			for _, s := range ss {
-				fmt.Fprintf(w, "%#v", s)
+		as := alerts{}
+		for _, a := range modelToLocal(resp.GetPayload()) {
+			if strings.HasPrefix(a.Fingerprint, args[0]) || a.Labels["alertname"] == args[0] {
+				as = append(as, a)
 			}
+		}
+
+		if len(as) == 0 {
+			fmt.Fprintf(w, "No alerts matched %q", args[0])
 			return nil
-		},
-	})
+		}
+
+		sort.Slice(as, func(i, j int) bool {
+			return as[i].StartsAt.After(as[j].StartsAt)
+		})
+
+		var out bytes.Buffer
+		graphs := []hugot.Attachment{}
+		seen := map[string]bool{}
+		for i, a := range as {
+			if i == maxShownAlerts {
+				fmt.Fprintf(&out, "... and %d more", len(as)-maxShownAlerts)
+				break
+			}
+			if err := p.templates().ExecuteTemplate(&out, "alert", a); err != nil {
+				return fmt.Errorf("error rendering template, %w", err)
+			}
+
+			expr := a.Expr()
+			if !*graph || expr == "" || seen[expr] {
+				continue
+			}
+			seen[expr] = true
+			graphs = append(graphs, hugot.Attachment{
+				Fallback: expr,
+				Title:    expr,
+				ImageURL: p.graphURL(expr, a.StartsAt.Add(-*before), time.Now()),
+			})
+		}
+		fmt.Fprint(w, out.String())
+
+		if len(graphs) != 0 {
+			w.Send(ctx, &hugot.Message{
+				Channel:     m.Channel,
+				Attachments: graphs,
+			})
+		}
+		return nil
+	}
+
+	root.AddCommand(cmd)
 }
 
-func (p *promH) alertsHook(w http.ResponseWriter, r *http.Request) {
-	rw, ok := hugot.ResponseWriterFromContext(r.Context())
-	if !ok {
-		http.NotFound(w, r)
+func (p *promH) alertFireCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "fire",
+		Short:   "send a test alert to alertmanager",
+		Example: "prometheus alerts fire TestAlert severity=page team=infra --annotation description=\"just testing\"",
+	}
+
+	annotations := cmd.Flags().StringArrayP("annotation", "a", nil, "annotations to add to the alert, as name=value")
+	dur := cmd.Flags().DurationP("duration", "d", 5*time.Minute, "how long before the alert resolves")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("you need to give an alertname")
+		}
+		if *dur <= 0 {
+			return fmt.Errorf("the duration must be positive")
+		}
+
+		ls, err := parseLabelSet(args[1:])
+		if err != nil {
+			return err
+		}
+		ls[string(model.AlertNameLabel)] = args[0]
+
+		as, err := parseLabelSet(*annotations)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		a := &modelv2.PostableAlert{
+			StartsAt:    strfmt.DateTime(now),
+			EndsAt:      strfmt.DateTime(now.Add(*dur)),
+			Annotations: as,
+			Alert: modelv2.Alert{
+				Labels: ls,
+			},
+		}
+
+		_, err = p.amclient.Alert.PostAlerts(&amalert.PostAlertsParams{
+			Context: ctx,
+			Alerts:  modelv2.PostableAlerts{a},
+		})
+		if err != nil {
+			return fmt.Errorf("could not post alert, %w", err)
+		}
+
+		fmt.Fprintf(w, "Fired %s, it will resolve in %s", strings.Join(KV(ls).Values(), " "), *dur)
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
+
+// parseLabelSet parses a list of name=value pairs.
+func parseLabelSet(args []string) (modelv2.LabelSet, error) {
+	ls := modelv2.LabelSet{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("bad label %q, expected name=value", arg)
+		}
+		if !model.LabelName(kv[0]).IsValid() {
+			return nil, fmt.Errorf("bad label name %q", kv[0])
+		}
+		ls[kv[0]] = strings.Trim(kv[1], `"`)
 	}
+	return ls, nil
+}
 
+func (p *promH) alertsHook(w http.ResponseWriter, r *http.Request) {
 	if glog.V(2) {
 		glog.Infof("%s %s", r.Method, r.URL)
 	}
 
-	hm := webhook.Message{}
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&hm); err != io.EOF && err != nil {
-		glog.Error(err.Error())
+	if r.Method != http.MethodPost {
+		hookError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
 		return
 	}
-	// Get rid of any trailing space after decode
-	io.Copy(ioutil.Discard, r.Body)
 
-	channel := bytes.Buffer{}
-	err := p.tmpls.ExecuteTemplate(&channel, "channel", &hm.Data)
+	hm, err := decodePayload(r.Body)
 	if err != nil {
-		glog.Infof("error expanding channel template, ", err.Error())
+		hookError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rw, ok := hugot.ResponseWriterFromContext(r.Context())
+	if !ok {
+		hookError(w, http.StatusInternalServerError, fmt.Errorf("no chat connection available"))
 		return
 	}
 
-	m := hugot.Message{}
-	m.Channel = channel.String()
-	atch, err := hugot.AttachmentFromTemplates(p.tmpls, &hm.Data)
+	ms, err := p.hookMessages(hm)
 	if err != nil {
-		glog.Infof("couldn't build attachment, %v", err)
+		hookError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	sent := []destMessage{}
+	for _, dm := range ms {
+		if p.batcher.add(hm.GroupKey, dm.dest, dm.data) {
+			continue
+		}
+		if !p.limiter.allow(hm.GroupKey, hm.Status, dm.dest, now) {
+			continue
+		}
+		p.addActions(dm.dest, dm.data, dm.m)
+		p.sendThreaded(r.Context(), rw, hm.GroupKey, hm.Status, dm.dest, dm.m)
+		sent = append(sent, dm)
+	}
+	if len(ms) > 0 {
+		p.trackAck(hm.GroupKey, ms[0].data, sent)
+		p.trackEscalation(ms[0].data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"success"}`))
+}
+
+// hookError logs the error and reports it to the webhook caller.
+// Alertmanager will retry notifications that get a 5xx response.
+func hookError(w http.ResponseWriter, code int, err error) {
+	glog.Errorf("alert webhook failed, %v", err)
+	writeJSONError(w, code, err)
+}
+
+// writeJSONError replies with a short JSON error body.
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}{"error", err.Error()})
+}
+
+// destMessage is a message to send to a destination, and the data it
+// was rendered from.
+type destMessage struct {
+	dest destination
+	m    *hugot.Message
+	data *tmplData
+}
+
+// hookMessages renders the messages to send for a webhook notification.
+func (p *promH) hookMessages(hm *webhook.Message) ([]destMessage, error) {
+	hm.ExternalURL = p.learnExternalURL(hm.ExternalURL)
+
+	d := hookToLocal(hm.Data)
+	d.ShortID = p.groups.add(d)
+	d.Ack = p.ackFor(d)
+
+	tmpls := p.templatesFor(d.CommonLabels)
+
+	dests, err := destinations(tmpls, d)
+	if err != nil {
+		return nil, fmt.Errorf("error expanding channels template, %w", err)
+	}
+
+	rm, err := renderMessage(tmpls, d)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := []destMessage{}
+	for _, dest := range dests {
+		m := dest.message()
+		m.Text = rm.Text
+		m.Attachments = append([]hugot.Attachment(nil), rm.Attachments...)
+		ms = append(ms, destMessage{dest, m, d})
+	}
+	return ms, nil
+}
+
+// destination is somewhere a notification should be sent, either a
+// channel, or a user, as a direct message.
+type destination struct {
+	Channel string
+	User    string
+}
+
+func (d destination) message() *hugot.Message {
+	if d.User != "" {
+		return &hugot.Message{To: d.User, Private: true}
+	}
+	return &hugot.Message{Channel: d.Channel}
+}
+
+// key identifies the destination, for per destination state.
+func (d destination) key() string {
+	if d.User != "" {
+		return "@" + d.User
 	}
+	return d.Channel
+}
 
-	m.Attachments = []hugot.Attachment{
-		atch,
+// destinations expands the channels template, which should give a list
+// of channels, and users prefixed with @, separated by commas or white
+// space.
+func destinations(tmpls *template.Template, d interface{}) ([]destination, error) {
+	var buf bytes.Buffer
+	if err := tmpls.ExecuteTemplate(&buf, "channels", d); err != nil {
+		return nil, err
 	}
 
-	rw.Send(context.TODO(), &m)
+	seen := map[string]bool{}
+	dests := []destination{}
+	for _, f := range strings.FieldsFunc(buf.String(), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		dest := destination{Channel: f}
+		if strings.HasPrefix(f, "@") {
+			dest = destination{User: strings.TrimPrefix(f, "@")}
+		}
+		if seen[dest.key()] {
+			continue
+		}
+		seen[dest.key()] = true
+		dests = append(dests, dest)
+	}
+
+	if len(dests) == 0 {
+		return nil, fmt.Errorf("no channels given")
+	}
+	return dests, nil
 }
 
 // Alert holds one alert for notification templates.
@@ -153,8 +454,16 @@ type alert struct {
 	StartsAt     time.Time `json:"startsAt"`
 	EndsAt       time.Time `json:"endsAt"`
 	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string    `json:"fingerprint"`
+	State        string    `json:"state"`
+	Receivers    []string  `json:"receivers"`
 	Silenced     string    `json:"silenced"`
+	SilencedBy   []string  `json:"silencedBy"`
 	Inhibited    bool      `json:"inhibited"`
+	InhibitedBy  []string  `json:"inhibitedBy"`
+
+	// status is the status Alertmanager gave the alert, if any.
+	status string
 }
 
 func modelToLocal(as []*modelv2.GettableAlert) alerts {
@@ -168,13 +477,28 @@ func modelToLocal(as []*modelv2.GettableAlert) alerts {
 			la.EndsAt = time.Time(*a.EndsAt)
 		}
 		la.GeneratorURL = a.GeneratorURL.String()
-		la.Labels = KV{}
-		if len(a.Status.SilencedBy) > 0 {
-			la.Silenced = a.Status.SilencedBy[0]
+		if a.Fingerprint != nil {
+			la.Fingerprint = *a.Fingerprint
 		}
-		if len(a.Status.InhibitedBy) > 0 {
-			la.Inhibited = true
+		for _, r := range a.Receivers {
+			if r != nil && r.Name != nil {
+				la.Receivers = append(la.Receivers, *r.Name)
+			}
+		}
+		if a.Status != nil {
+			if a.Status.State != nil {
+				la.State = *a.Status.State
+			}
+			la.SilencedBy = a.Status.SilencedBy
+			if len(a.Status.SilencedBy) > 0 {
+				la.Silenced = a.Status.SilencedBy[0]
+			}
+			la.InhibitedBy = a.Status.InhibitedBy
+			if len(a.Status.InhibitedBy) > 0 {
+				la.Inhibited = true
+			}
 		}
+		la.Labels = KV{}
 		for k, v := range a.Labels {
 			la.Labels[string(k)] = string(v)
 		}
@@ -188,6 +512,43 @@ func modelToLocal(as []*modelv2.GettableAlert) alerts {
 	return las
 }
 
+// Expr returns the PromQL expression of the rule that generated the
+// alert, taken from the generator URL.
+func (a *alert) Expr() string {
+	u, err := url.Parse(a.GeneratorURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("g0.expr")
+}
+
+// hookToLocal converts the data from a webhook notification to the same
+// form used for the alerts command, so that templates see the same
+// types and methods either way.
+func hookToLocal(hd *amT.Data) *tmplData {
+	d := &tmplData{
+		Receiver:          hd.Receiver,
+		Status:            hd.Status,
+		Alerts:            alerts{},
+		GroupLabels:       KV(hd.GroupLabels).clone(),
+		CommonLabels:      KV(hd.CommonLabels).clone(),
+		CommonAnnotations: KV(hd.CommonAnnotations).clone(),
+		ExternalURL:       hd.ExternalURL,
+	}
+	for _, a := range hd.Alerts {
+		d.Alerts = append(d.Alerts, alert{
+			Labels:       KV(a.Labels).clone(),
+			Annotations:  KV(a.Annotations).clone(),
+			StartsAt:     a.StartsAt,
+			EndsAt:       a.EndsAt,
+			GeneratorURL: a.GeneratorURL,
+			Fingerprint:  a.Fingerprint,
+			status:       a.Status,
+		})
+	}
+	return d
+}
+
 // alerts is a list of Alert objects.
 type alerts []alert
 
@@ -207,15 +568,18 @@ func (a *alert) ResolvedAt(ts time.Time) bool {
 
 // Status returns the status of the alert.
 func (a *alert) Status() string {
+	if a.status != "" {
+		return a.status
+	}
 	if a.Resolved() {
-		return "resolved"
+		return string(model.AlertResolved)
 	}
-	return "FIring"
+	return string(model.AlertFiring)
 }
 
 // Firing returns the subset of alerts that are firing.
-func (as alerts) Firing() []alert {
-	res := []alert{}
+func (as alerts) Firing() alerts {
+	res := alerts{}
 	for _, a := range as {
 		if a.Status() == string(model.AlertFiring) {
 			res = append(res, a)
@@ -232,8 +596,8 @@ func (as alerts) Status() string {
 }
 
 // Resolved returns the subset of alerts that are resolved.
-func (as alerts) Resolved() []alert {
-	res := []alert{}
+func (as alerts) Resolved() alerts {
+	res := alerts{}
 	for _, a := range as {
 		if a.Status() == string(model.AlertResolved) {
 			res = append(res, a)
@@ -328,6 +692,8 @@ func (kv KV) clone() KV {
 	return res
 }
 
+// tmplData is the data passed to the notification templates, for both
+// webhook notifications and the alerts command.
 type tmplData struct {
 	Receiver          string
 	Status            string
@@ -336,9 +702,12 @@ type tmplData struct {
 	CommonLabels      KV
 	CommonAnnotations KV
 	ExternalURL       string
+	ShortID           string
+	// Ack is the acknowledgement for the group, or nil.
+	Ack *Ack
 }
 
-func data(amc *client.Alertmanager, recv string, groupLabels modelv2.LabelSet, as alerts) *tmplData {
+func data(externalURL string, recv string, groupLabels modelv2.LabelSet, as alerts) *tmplData {
 
 	data := &tmplData{
 		Receiver:          strings.SplitN(recv, "/", 2)[0],
@@ -347,7 +716,7 @@ func data(amc *client.Alertmanager, recv string, groupLabels modelv2.LabelSet, a
 		GroupLabels:       map[string]string{},
 		CommonLabels:      map[string]string{},
 		CommonAnnotations: map[string]string{},
-		//ExternalURL:       amc.Endpoint().String(),
+		ExternalURL:       externalURL,
 	}
 
 	for k, v := range groupLabels {
@@ -381,23 +750,6 @@ func data(amc *client.Alertmanager, recv string, groupLabels modelv2.LabelSet, a
 	return data
 }
 
-func (p *promH) alertMessage(d interface{}) (*hugot.Message, error) {
-	var channel bytes.Buffer
-	err := p.tmpls.ExecuteTemplate(&channel, "channel", d)
-	if err != nil {
-		return nil, fmt.Errorf("can't expand channel template, %w", err)
-	}
-
-	m := hugot.Message{}
-	atch, err := hugot.AttachmentFromTemplates(p.tmpls, d)
-	if err != nil {
-		glog.Infof("couldn't build attachment, %v", err)
-	}
-
-	glog.Infof("atch, %v", atch)
-
-	m.Attachments = []hugot.Attachment{
-		atch,
-	}
-	return &m, nil
+func (p *promH) alertMessage(d *tmplData) (*hugot.Message, error) {
+	return renderMessage(p.templatesFor(d.CommonLabels), d)
 }
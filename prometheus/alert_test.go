@@ -0,0 +1,349 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/tcolgate/hugot"
+)
+
+func TestDestinations(t *testing.T) {
+	tmpls := template.Must(template.New("channels").Funcs(TemplateFuncs).Parse(`alerts, ops {{ .User }}
+alerts`))
+	dests, err := destinations(defaultTmpls(tmpls), struct{ User string }{"@oncall"})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	exp := []destination{
+		{Channel: "alerts"},
+		{Channel: "ops"},
+		{User: "oncall"},
+	}
+	if !reflect.DeepEqual(dests, exp) {
+		t.Fatalf("expected %v, got %v", exp, dests)
+	}
+}
+
+// newTestHandler returns a handler with all its state set up, as New
+// does, and the default templates, but no clients.
+func newTestHandler() *promH {
+	p := &promH{
+		groups:  newRecentGroups(maxRecentGroups),
+		threads: newThreads(),
+		limiter: newLimiter(),
+		batcher: newBatcher(),
+		acks:    newAcks(),
+		escs:    newEscalations(),
+
+		actionAuth: ActionAuth{Key: newActionKey()},
+	}
+	p.setTemplates(defaultTmpls(nil))
+	return p
+}
+
+const testHookBody = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"TestAlert\"}",
+  "status": "firing",
+  "receiver": "hugot",
+  "groupLabels": {"alertname": "TestAlert"},
+  "commonLabels": {"alertname": "TestAlert", "severity": "page"},
+  "commonAnnotations": {"description": "testing"},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "TestAlert", "severity": "page"},
+      "annotations": {"description": "testing"},
+      "startsAt": "2020-05-01T10:00:00Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0"
+    }
+  ]
+}`
+
+func TestAlertsHookErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		channels string
+		noChat   bool
+		exp      int
+	}{
+		{name: "bad method", method: "GET", exp: http.StatusMethodNotAllowed},
+		{name: "empty body", body: "", exp: http.StatusBadRequest},
+		{name: "bad json", body: "{", exp: http.StatusBadRequest},
+		{name: "no data", body: `{"version":"4"}`, exp: http.StatusBadRequest},
+		{name: "no version", body: `{"status":"firing"}`, exp: http.StatusBadRequest},
+		{name: "unknown version", body: `{"version":"5"}`, exp: http.StatusBadRequest},
+		{name: "bad template", body: testHookBody, channels: `{{ .NoSuchField }}`, exp: http.StatusInternalServerError},
+		{name: "no chat connection", body: testHookBody, noChat: true, exp: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		tmpls := template.New("test").Funcs(TemplateFuncs)
+		if tt.channels != "" {
+			template.Must(tmpls.New("channels").Parse(tt.channels))
+		}
+		p := newTestHandler()
+		p.setTemplates(defaultTmpls(tmpls))
+
+		method := tt.method
+		if method == "" {
+			method = "POST"
+		}
+		r := httptest.NewRequest(method, "/alerts", strings.NewReader(tt.body))
+		if !tt.noChat {
+			r = r.WithContext(hugot.NewResponseWriterContext(r.Context(), newFakeWriter()))
+		}
+		w := httptest.NewRecorder()
+		p.alertsHook(w, r)
+
+		if w.Code != tt.exp {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.exp, w.Code)
+			continue
+		}
+		if tt.noChat {
+			if _, ok := p.groups.get(groupID("hugot", KV{"alertname": "TestAlert"})); ok {
+				t.Errorf("%s: expected the group not to be recorded", tt.name)
+			}
+		}
+
+		res := struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}{}
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Errorf("%s: could not decode response, %v", tt.name, err)
+			continue
+		}
+		if res.Status != "error" || res.Error == "" {
+			t.Errorf("%s: expected an error response, got %#v", tt.name, res)
+		}
+	}
+}
+
+func TestAlertsHook(t *testing.T) {
+	p := newTestHandler()
+
+	fw := newFakeWriter()
+	r := httptest.NewRequest("POST", "/alerts", strings.NewReader(testHookBody))
+	r = r.WithContext(hugot.NewResponseWriterContext(r.Context(), fw))
+	w := httptest.NewRecorder()
+	p.alertsHook(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d, %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response, got %q", ct)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"status":"success"}` {
+		t.Errorf("unexpected response %s", body)
+	}
+
+	if len(fw.sent) != 1 {
+		t.Fatalf("expected one notification, got %d", len(fw.sent))
+	}
+	if m := fw.sent[0]; m.Channel != "alerts" || len(m.Attachments) != 1 {
+		t.Errorf("expected an attachment in the alerts channel, got %#v", m)
+	}
+	if _, ok := p.groups.get(groupID("hugot", KV{"alertname": "TestAlert"})); !ok {
+		t.Errorf("expected the group to be recorded")
+	}
+}
+
+func TestModelToLocal(t *testing.T) {
+	starts := strfmt.DateTime(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC))
+	ends := strfmt.DateTime(time.Date(2020, 5, 1, 11, 0, 0, 0, time.UTC))
+	fp, state, recv := "3ba2e0ad2bcf0e41", "suppressed", "hugot"
+	as := modelToLocal([]*modelv2.GettableAlert{
+		{
+			Annotations: modelv2.LabelSet{"description": "disk full"},
+			StartsAt:    &starts,
+			EndsAt:      &ends,
+			Fingerprint: &fp,
+			Receivers:   []*modelv2.Receiver{{Name: &recv}, nil, {}},
+			Status: &modelv2.AlertStatus{
+				State:       &state,
+				SilencedBy:  []string{"silence-1", "silence-2"},
+				InhibitedBy: []string{"inhibitor"},
+			},
+			Alert: modelv2.Alert{
+				Labels:       modelv2.LabelSet{"alertname": "DiskFull", "instance": "host1"},
+				GeneratorURL: strfmt.URI("http://prometheus:9090/graph?g0.expr=up+%3D%3D+0"),
+			},
+		},
+		{},
+	})
+	if len(as) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(as))
+	}
+
+	a := as[0]
+	if a.Fingerprint != fp || a.State != state {
+		t.Errorf("expected fingerprint %s and state %s, got %s and %s", fp, state, a.Fingerprint, a.State)
+	}
+	if !reflect.DeepEqual(a.Receivers, []string{"hugot"}) {
+		t.Errorf("expected receivers [hugot], got %v", a.Receivers)
+	}
+	if a.Silenced != "silence-1" || !a.Inhibited {
+		t.Errorf("expected silenced by silence-1 and inhibited, got %q %v", a.Silenced, a.Inhibited)
+	}
+
+	var buf bytes.Buffer
+	if err := defaultTmpls(nil).ExecuteTemplate(&buf, "alert", a); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	exp := `**DiskFull** (3ba2e0ad2bcf0e41) suppressed
+Started: 2020-05-01 10:00:00 UTC, ends: 2020-05-01 11:00:00 UTC
+Source: http://prometheus:9090/graph?g0.expr=up+%3D%3D+0
+Receivers: hugot
+Silenced by: silence-1, silence-2
+Inhibited by: inhibitor
+Labels:
+- alertname: DiskFull
+- instance: host1
+Annotations:
+- description: disk full
+`
+	if buf.String() != exp {
+		t.Errorf("expected %q, got %q", exp, buf.String())
+	}
+
+	empty := as[1]
+	if !empty.StartsAt.IsZero() || empty.Fingerprint != "" || empty.State != "" {
+		t.Errorf("expected an empty alert to convert to zero values, got %#v", empty)
+	}
+	if s := empty.Status(); s != "firing" {
+		t.Errorf("expected an alert with no end to be firing, got %s", s)
+	}
+}
+
+func TestParseLabelSet(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		value string
+		err   bool
+	}{
+		{in: "a=b", name: "a", value: "b"},
+		{in: `summary="disk full"`, name: "summary", value: "disk full"},
+		{in: "a=b=c", name: "a", value: "b=c"},
+		{in: "a=", name: "a", value: ""},
+		{in: "=x", err: true},
+		{in: "a", err: true},
+		{in: "1a=b", err: true},
+		{in: "a-b=c", err: true},
+	}
+
+	for _, tt := range tests {
+		ls, err := parseLabelSet([]string{tt.in})
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", tt.in, err)
+			continue
+		}
+		if v, ok := ls[tt.name]; !ok || v != tt.value || len(ls) != 1 {
+			t.Errorf("%q: expected %s=%q, got %v", tt.in, tt.name, tt.value, ls)
+		}
+	}
+}
+
+func TestAlertGroupsParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    []string
+		receiver  string
+		silenced  bool
+		inhibited bool
+		active    bool
+		err       bool
+	}{
+		{name: "defaults", active: true},
+		{name: "receiver", receiver: "hugot|ops", active: true},
+		{name: "states", filter: []string{"alertname=Foo", `job=~"node.*"`}, silenced: true, inhibited: true},
+		{name: "bad matcher", filter: []string{"alertname=Foo", "job!=node"}, active: true, err: true},
+	}
+
+	for _, tt := range tests {
+		params, err := alertGroupsParams(context.Background(), tt.filter, tt.receiver, tt.silenced, tt.inhibited, tt.active)
+		if tt.err {
+			if err == nil || params != nil {
+				t.Errorf("%s: expected an error and no query, got %v", tt.name, params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error, %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(params.Filter, tt.filter) {
+			t.Errorf("%s: expected filter %v, got %v", tt.name, tt.filter, params.Filter)
+		}
+		switch {
+		case tt.receiver == "" && params.Receiver != nil:
+			t.Errorf("%s: expected no receiver, got %q", tt.name, *params.Receiver)
+		case tt.receiver != "" && (params.Receiver == nil || *params.Receiver != tt.receiver):
+			t.Errorf("%s: expected receiver %q, got %v", tt.name, tt.receiver, params.Receiver)
+		}
+		if params.Silenced == nil || *params.Silenced != tt.silenced ||
+			params.Inhibited == nil || *params.Inhibited != tt.inhibited ||
+			params.Active == nil || *params.Active != tt.active {
+			t.Errorf("%s: expected silenced %v, inhibited %v and active %v, got %v %v %v", tt.name,
+				tt.silenced, tt.inhibited, tt.active, params.Silenced, params.Inhibited, params.Active)
+		}
+	}
+}
+
+func TestExternalURL(t *testing.T) {
+	p := &promH{}
+	tmpls := defaultTmpls(nil)
+	link := func(u string) string {
+		var buf bytes.Buffer
+		if err := tmpls.ExecuteTemplate(&buf, "title_link", &tmplData{Receiver: "team a", ExternalURL: u}); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		return buf.String()
+	}
+
+	if u := p.getExternalURL(); u != "" || link(u) != "" {
+		t.Errorf("expected no URL or title link, got %q and %q", u, link(u))
+	}
+
+	if u := p.learnExternalURL("http://alertmanager:9093/"); u != "http://alertmanager:9093" {
+		t.Errorf("expected the URL from the webhook, got %q", u)
+	}
+	if u := p.learnExternalURL(""); u != "http://alertmanager:9093" {
+		t.Errorf("expected an empty URL to be ignored, got %q", u)
+	}
+	if l := link(p.getExternalURL()); l != "http://alertmanager:9093/#/alerts?receiver=team+a" {
+		t.Errorf("expected a link to the receiver's alerts, got %q", l)
+	}
+
+	p.SetExternalURL("https://alerts.example.com/")
+	if u := p.learnExternalURL("http://alertmanager:9093"); u != "https://alerts.example.com" {
+		t.Errorf("expected the URL that was set to take precedence, got %q", u)
+	}
+	if u := p.getExternalURL(); u != "https://alerts.example.com" {
+		t.Errorf("expected the URL that was set, got %q", u)
+	}
+}
@@ -0,0 +1,125 @@
+package prometheus
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WebhookAuth configures how incoming Alertmanager webhooks are
+// verified. Any combination of the checks may be used, an empty
+// WebhookAuth accepts all requests.
+type WebhookAuth struct {
+	// BearerToken, if set, must match the bearer_token in the
+	// Alertmanager webhook http_config.
+	BearerToken string
+	// Username and Password, if set, must match the basic_auth in the
+	// Alertmanager webhook http_config.
+	Username string
+	Password string
+	// AllowedCIDRs, if set, limits the source addresses that may send
+	// webhooks. The address is taken from the connection, any
+	// X-Forwarded-For header is ignored.
+	AllowedCIDRs []string
+
+	nets []*net.IPNet
+}
+
+// SetWebhookAuth sets the verification applied to incoming Alertmanager
+// webhooks.
+func (p *promH) SetWebhookAuth(a WebhookAuth) error {
+	a.nets = nil
+	for _, c := range a.AllowedCIDRs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("bad allowed CIDR %q, %w", c, err)
+		}
+		a.nets = append(a.nets, n)
+	}
+	if a.Password != "" && a.Username == "" {
+		return fmt.Errorf("a webhook password needs a username")
+	}
+	if a.BearerToken != "" && a.Username != "" {
+		return fmt.Errorf("webhooks can use a bearer token or basic auth, not both")
+	}
+
+	p.authMu.Lock()
+	defer p.authMu.Unlock()
+	p.auth = a
+	return nil
+}
+
+// checkSource returns true if the request came from an allowed address.
+func (a *WebhookAuth) checkSource(r *http.Request) bool {
+	if len(a.nets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCredentials returns true if the request carries the configured
+// credentials.
+func (a *WebhookAuth) checkCredentials(r *http.Request) bool {
+	if a.BearerToken != "" {
+		h := r.Header.Get("Authorization")
+		if !strings.HasPrefix(h, "Bearer ") {
+			return false
+		}
+		tok := strings.TrimPrefix(h, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(a.BearerToken)) != 1 {
+			return false
+		}
+	}
+	if a.Username != "" {
+		u, pw, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		uok := subtle.ConstantTimeCompare([]byte(u), []byte(a.Username)) == 1
+		pok := subtle.ConstantTimeCompare([]byte(pw), []byte(a.Password)) == 1
+		if !uok || !pok {
+			return false
+		}
+	}
+	return true
+}
+
+// authorized wraps a webhook handler with the configured WebhookAuth
+// checks.
+func (p *promH) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.authMu.RLock()
+		a := p.auth
+		p.authMu.RUnlock()
+
+		if !a.checkSource(r) {
+			hookError(w, http.StatusForbidden, fmt.Errorf("source %s not allowed", r.RemoteAddr))
+			return
+		}
+
+		if !a.checkCredentials(r) {
+			if a.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="hugot"`)
+			}
+			hookError(w, http.StatusUnauthorized, fmt.Errorf("bad credentials from %s", r.RemoteAddr))
+			return
+		}
+
+		h(w, r)
+	}
+}
@@ -0,0 +1,97 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   WebhookAuth
+		remote string
+		setup  func(r *http.Request)
+		exp    int
+	}{
+		{name: "open", exp: http.StatusOK},
+		{
+			name:  "bearer ok",
+			auth:  WebhookAuth{BearerToken: "s3cret"},
+			setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") },
+			exp:   http.StatusOK,
+		},
+		{
+			name:  "bearer bad",
+			auth:  WebhookAuth{BearerToken: "s3cret"},
+			setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+			exp:   http.StatusUnauthorized,
+		},
+		{
+			name: "bearer missing",
+			auth: WebhookAuth{BearerToken: "s3cret"},
+			exp:  http.StatusUnauthorized,
+		},
+		{
+			name:  "basic ok",
+			auth:  WebhookAuth{Username: "am", Password: "pw"},
+			setup: func(r *http.Request) { r.SetBasicAuth("am", "pw") },
+			exp:   http.StatusOK,
+		},
+		{
+			name:  "basic bad",
+			auth:  WebhookAuth{Username: "am", Password: "pw"},
+			setup: func(r *http.Request) { r.SetBasicAuth("am", "nope") },
+			exp:   http.StatusUnauthorized,
+		},
+		{
+			name:   "cidr ok",
+			auth:   WebhookAuth{AllowedCIDRs: []string{"10.0.0.0/8"}},
+			remote: "10.1.2.3:4567",
+			exp:    http.StatusOK,
+		},
+		{
+			name:   "cidr bad",
+			auth:   WebhookAuth{AllowedCIDRs: []string{"10.0.0.0/8"}},
+			remote: "192.168.1.1:4567",
+			exp:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		p := &promH{}
+		if err := p.SetWebhookAuth(tt.auth); err != nil {
+			t.Fatalf("%s: unexpected error, %v", tt.name, err)
+		}
+		h := p.authorized(func(w http.ResponseWriter, r *http.Request) {})
+
+		r := httptest.NewRequest("POST", "/alerts", nil)
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+		if tt.setup != nil {
+			tt.setup(r)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != tt.exp {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.exp, w.Code)
+		}
+		if tt.exp == http.StatusOK {
+			continue
+		}
+
+		var body struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected a JSON error, got content type %q", tt.name, ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Status != "error" || body.Error == "" {
+			t.Errorf("%s: expected a JSON error body, got %q", tt.name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// Batching configures destinations whose webhook notifications are
+// collected up, and sent as a single digest at a fixed interval.
+type Batching struct {
+	// Interval is how often digests are sent, it defaults to ten
+	// minutes.
+	Interval time.Duration
+	// Destinations lists the channels, or users prefixed with @, that
+	// should get digests.
+	Destinations []string
+}
+
+// batch holds the notifications waiting to be sent to one destination.
+type batch struct {
+	dest  destination
+	order []string
+	byKey map[string]*tmplData
+}
+
+// digestData holds the data for the digest template.
+type digestData struct {
+	Destination string
+	Groups      []*tmplData
+	ExternalURL string
+}
+
+// batcher collects notifications for batched destinations.
+type batcher struct {
+	sync.Mutex
+	interval time.Duration
+	dests    map[string]bool
+	batches  map[string]*batch
+}
+
+func newBatcher() *batcher {
+	return &batcher{
+		dests:   map[string]bool{},
+		batches: map[string]*batch{},
+	}
+}
+
+// SetBatching sets which destinations get their notifications as a
+// periodic digest.
+func (p *promH) SetBatching(b Batching) {
+	p.batcher.Lock()
+	defer p.batcher.Unlock()
+	p.batcher.interval = b.Interval
+	p.batcher.dests = map[string]bool{}
+	for _, d := range b.Destinations {
+		p.batcher.dests[d] = true
+	}
+}
+
+func (b *batcher) digestInterval() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	if b.interval <= 0 {
+		return 10 * time.Minute
+	}
+	return b.interval
+}
+
+// add queues the notification if the destination is batched, and
+// reports whether it did so. Only the latest notification for each
+// group is kept.
+func (b *batcher) add(groupKey string, dest destination, d *tmplData) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	dk := dest.key()
+	if !b.dests[dk] {
+		return false
+	}
+
+	bt, ok := b.batches[dk]
+	if !ok {
+		bt = &batch{dest: dest, byKey: map[string]*tmplData{}}
+		b.batches[dk] = bt
+	}
+	if _, ok := bt.byKey[groupKey]; !ok {
+		bt.order = append(bt.order, groupKey)
+	}
+	bt.byKey[groupKey] = d
+	return true
+}
+
+// take returns, and clears, the pending batches.
+func (b *batcher) take() []*batch {
+	b.Lock()
+	defer b.Unlock()
+
+	bts := []*batch{}
+	for _, bt := range b.batches {
+		bts = append(bts, bt)
+	}
+	b.batches = map[string]*batch{}
+
+	sort.Slice(bts, func(i, j int) bool {
+		return bts[i].dest.key() < bts[j].dest.key()
+	})
+	return bts
+}
+
+// sendBatches renders and posts a digest to each destination with
+// pending notifications.
+func (p *promH) sendBatches(ctx context.Context, w hugot.ResponseWriter) {
+	for _, bt := range p.batcher.take() {
+		dd := &digestData{
+			Destination: bt.dest.key(),
+			ExternalURL: p.getExternalURL(),
+		}
+		for _, k := range bt.order {
+			dd.Groups = append(dd.Groups, bt.byKey[k])
+		}
+
+		var out bytes.Buffer
+		if err := p.templates().ExecuteTemplate(&out, "digest", dd); err != nil {
+			glog.Errorf("error expanding digest template for %s, %v", bt.dest.key(), err)
+			continue
+		}
+
+		m := bt.dest.message()
+		m.Text = out.String()
+		w.Send(ctx, m)
+	}
+}
@@ -0,0 +1,32 @@
+package prometheus
+
+import (
+	"testing"
+)
+
+func TestBatcher(t *testing.T) {
+	b := newBatcher()
+	b.dests["low"] = true
+
+	if b.add("a", destination{Channel: "alerts"}, &tmplData{}) {
+		t.Fatalf("expected unbatched destination not to be queued")
+	}
+
+	low := destination{Channel: "low"}
+	first, latest := &tmplData{ShortID: "1"}, &tmplData{ShortID: "2"}
+	b.add("a", low, first)
+	b.add("b", low, &tmplData{ShortID: "3"})
+	b.add("a", low, latest)
+
+	bts := b.take()
+	if len(bts) != 1 {
+		t.Fatalf("expected one batch, got %d", len(bts))
+	}
+	bt := bts[0]
+	if len(bt.order) != 2 || bt.order[0] != "a" || bt.byKey["a"] != latest {
+		t.Fatalf("expected latest notification per group, in order, got %v", bt.order)
+	}
+	if len(b.take()) != 0 {
+		t.Fatalf("expected batches to be cleared")
+	}
+}
@@ -0,0 +1,71 @@
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// TestTemplateConformance checks that the templates render the same
+// whether the data came from a webhook notification, or from the
+// Alertmanager API for the alerts command.
+func TestTemplateConformance(t *testing.T) {
+	hm, err := decodePayload(strings.NewReader(testHookBody))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	hd := hookToLocal(hm.Data)
+	hd.ShortID = groupID(hd.Receiver, hd.GroupLabels)
+
+	starts := strfmt.DateTime(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC))
+	ends := strfmt.DateTime(time.Now().Add(5 * time.Minute))
+	fp, state, recv := "3ba2e0ad2bcf0e41", "active", "hugot"
+	ga := &modelv2.GettableAlert{
+		Annotations: modelv2.LabelSet{"description": "testing"},
+		StartsAt:    &starts,
+		EndsAt:      &ends,
+		Fingerprint: &fp,
+		Receivers:   []*modelv2.Receiver{{Name: &recv}},
+		Status: &modelv2.AlertStatus{
+			State:       &state,
+			SilencedBy:  []string{},
+			InhibitedBy: []string{},
+		},
+		Alert: modelv2.Alert{
+			Labels:       modelv2.LabelSet{"alertname": "TestAlert", "severity": "page"},
+			GeneratorURL: strfmt.URI("http://prometheus:9090/graph?g0.expr=up+%3D%3D+0"),
+		},
+	}
+	cd := data("http://alertmanager:9093", recv, modelv2.LabelSet{"alertname": "TestAlert"}, modelToLocal([]*modelv2.GettableAlert{ga}))
+	cd.ShortID = groupID(cd.Receiver, cd.GroupLabels)
+
+	tmpls := defaultTmpls(template.Must(template.New("methods").Funcs(TemplateFuncs).Parse(
+		`{{ .Status }} {{ .Alerts.Firing | len }} {{ .Alerts.Resolved | len }} {{ range .Alerts.Firing }}{{ .Status }} {{ .Labels.SortedPairs.Names | join "," }}{{ end }}`)))
+
+	names := append([]string{"channel", "methods"}, notificationTmpls...)
+	for _, n := range names {
+		var hb, cb bytes.Buffer
+		if err := tmpls.ExecuteTemplate(&hb, n, hd); err != nil {
+			t.Errorf("%s: webhook data failed, %v", n, err)
+			continue
+		}
+		if err := tmpls.ExecuteTemplate(&cb, n, cd); err != nil {
+			t.Errorf("%s: command data failed, %v", n, err)
+			continue
+		}
+		if hb.String() != cb.String() {
+			t.Errorf("%s: webhook data gave %q, command data gave %q", n, hb.String(), cb.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	tmpls.ExecuteTemplate(&buf, "methods", hd)
+	if exp := "firing 1 0 firing alertname,severity"; buf.String() != exp {
+		t.Errorf("expected %q, got %q", exp, buf.String())
+	}
+}
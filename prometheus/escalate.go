@@ -0,0 +1,246 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// Escalation configures the escalation of alert groups that are not
+// acknowledged in time. Each user is sent a direct message in turn,
+// waiting After between each, and then the channel is posted to.
+type Escalation struct {
+	// Label and Value pick the groups to escalate, by a label common to
+	// all their alerts. They default to severity=page.
+	Label string
+	Value string
+	// After is how long to wait for an acknowledgement before each step,
+	// it is checked once a minute.
+	After time.Duration
+	// Users are sent a direct message, in order.
+	Users []string
+	// Channel is posted to once all the users have been tried.
+	Channel string
+	// StateFile, if set, is where escalations in progress are kept, so
+	// that they survive a restart.
+	StateFile string
+}
+
+// maxEscalationAge is how long a group is remembered after everyone has
+// been told about it. Until then repeat notifications for the group do
+// not start a new escalation. After it, the group is dropped in case its
+// resolve notification was missed.
+const maxEscalationAge = 24 * time.Hour
+
+// escalationState is the progress of the escalation of one group.
+type escalationState struct {
+	Group       string    `json:"group"`
+	GroupLabels KV        `json:"groupLabels"`
+	Summary     string    `json:"summary"`
+	StartsAt    time.Time `json:"startsAt"`
+	Step        int       `json:"step"`
+	Next        time.Time `json:"next"`
+}
+
+// escalationStep is a message to send for an escalation.
+type escalationStep struct {
+	dest destination
+	text string
+}
+
+// escalations tracks the groups being escalated, by short ID.
+type escalations struct {
+	sync.Mutex
+	conf   Escalation
+	states map[string]*escalationState
+}
+
+func newEscalations() *escalations {
+	return &escalations{states: map[string]*escalationState{}}
+}
+
+// SetEscalation enables escalation of unacknowledged alert groups. If
+// a state file is given, any escalations saved in it are resumed.
+func (p *promH) SetEscalation(e Escalation) error {
+	if e.After <= 0 {
+		return fmt.Errorf("escalation needs a positive interval")
+	}
+	if len(e.Users) == 0 && e.Channel == "" {
+		return fmt.Errorf("escalation needs users or a channel to escalate to")
+	}
+	if e.Label == "" {
+		e.Label, e.Value = "severity", "page"
+	}
+
+	states := map[string]*escalationState{}
+	if e.StateFile != "" {
+		bs, err := ioutil.ReadFile(e.StateFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(bs, &states); err != nil {
+				return fmt.Errorf("could not read escalations from %s, %w", e.StateFile, err)
+			}
+		}
+	}
+
+	p.escs.Lock()
+	defer p.escs.Unlock()
+	p.escs.conf = e
+	p.escs.states = states
+	return nil
+}
+
+// save writes the escalation state file, if there is one. It must be
+// called with the lock held.
+func (es *escalations) save() {
+	if es.conf.StateFile == "" {
+		return
+	}
+	if err := writeJSONFile(es.conf.StateFile, es.states); err != nil {
+		glog.Errorf("could not save escalations, %v", err)
+	}
+}
+
+// escalatingGroup returns the group labels of a group being escalated.
+func (p *promH) escalatingGroup(id string) (KV, bool) {
+	p.escs.Lock()
+	defer p.escs.Unlock()
+	st, ok := p.escs.states[id]
+	if !ok {
+		return nil, false
+	}
+	return st.GroupLabels, true
+}
+
+// trackEscalation starts escalating an unacknowledged group that
+// matches the escalation label, and stops once it is acknowledged or
+// resolves.
+func (p *promH) trackEscalation(d *tmplData) {
+	p.escs.Lock()
+	defer p.escs.Unlock()
+
+	es := p.escs
+	if es.conf.After <= 0 {
+		return
+	}
+
+	_, ok := es.states[d.ShortID]
+	if d.Status == "resolved" || d.Ack != nil {
+		if ok {
+			delete(es.states, d.ShortID)
+			es.save()
+		}
+		return
+	}
+	if ok || d.CommonLabels[es.conf.Label] != es.conf.Value {
+		return
+	}
+
+	st := &escalationState{
+		Group:       d.ShortID,
+		GroupLabels: d.GroupLabels.clone(),
+		Summary:     strings.Join(d.GroupLabels.Values(), " "),
+		StartsAt:    time.Now(),
+		Next:        time.Now().Add(es.conf.After),
+	}
+	var buf bytes.Buffer
+	if err := p.templatesFor(d.CommonLabels).ExecuteTemplate(&buf, "fallback", d); err == nil {
+		st.Summary = strings.TrimSpace(buf.String())
+	}
+	for _, a := range d.Alerts {
+		if !a.StartsAt.IsZero() && a.StartsAt.Before(st.StartsAt) {
+			st.StartsAt = a.StartsAt
+		}
+	}
+
+	es.states[d.ShortID] = st
+	es.save()
+}
+
+// dueEscalations returns the escalation messages due to be sent, and
+// moves each escalation on to its next step. Groups acknowledged since
+// they started are dropped.
+func (p *promH) dueEscalations(now time.Time) []escalationStep {
+	store := p.acks.getStore()
+
+	p.escs.Lock()
+	defer p.escs.Unlock()
+
+	es := p.escs
+	ids := []string{}
+	for id := range es.states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	steps := []escalationStep{}
+	changed := false
+	for _, id := range ids {
+		st := es.states[id]
+		if now.Before(st.Next) {
+			continue
+		}
+
+		if a, ok, _ := store.GetAck(id); ok && a.At.After(st.StartsAt) {
+			delete(es.states, id)
+			changed = true
+			continue
+		}
+
+		msg := fmt.Sprintf("%s has not been acknowledged for %s\nacknowledge with: prometheus ack %s",
+			st.Summary, now.Sub(st.StartsAt).Round(time.Minute), id)
+		switch {
+		case st.Step < len(es.conf.Users):
+			steps = append(steps, escalationStep{
+				dest: destination{User: es.conf.Users[st.Step]},
+				text: msg,
+			})
+		case st.Step == len(es.conf.Users) && es.conf.Channel != "":
+			if len(es.conf.Users) > 0 {
+				msg += fmt.Sprintf("\nalready tried: @%s", strings.Join(es.conf.Users, ", @"))
+			}
+			steps = append(steps, escalationStep{
+				dest: destination{Channel: es.conf.Channel},
+				text: msg,
+			})
+		default:
+			// Everyone has been told, the group is kept until
+			// maxEscalationAge.
+			if now.Sub(st.Next) > maxEscalationAge {
+				delete(es.states, id)
+				changed = true
+			}
+			continue
+		}
+		changed = true
+		st.Step++
+		st.Next = now.Add(es.conf.After)
+	}
+
+	if changed {
+		es.save()
+	}
+	return steps
+}
+
+// sendEscalations sends any escalation messages that are due.
+func (p *promH) sendEscalations(ctx context.Context, w hugot.ResponseWriter) {
+	for _, s := range p.dueEscalations(time.Now()) {
+		m := s.dest.message()
+		m.Text = s.text
+		w.Send(ctx, m)
+	}
+}
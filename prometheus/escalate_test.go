@@ -0,0 +1,92 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEscalation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "escalations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newP := func() *promH {
+		p := newTestHandler()
+		err := p.SetEscalation(Escalation{
+			After:     10 * time.Minute,
+			Users:     []string{"alice", "bob"},
+			Channel:   "escalations",
+			StateFile: filepath.Join(dir, "escalations.json"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		return p
+	}
+	p := newP()
+
+	start := time.Now()
+	page := &tmplData{
+		Status:       "firing",
+		GroupLabels:  KV{"alertname": "DiskFull"},
+		CommonLabels: KV{"alertname": "DiskFull", "severity": "page"},
+		Alerts:       alerts{{StartsAt: start}},
+	}
+	page.ShortID = p.groups.add(page)
+	p.trackEscalation(page)
+
+	info := &tmplData{
+		Status:       "firing",
+		GroupLabels:  KV{"alertname": "Noisy"},
+		CommonLabels: KV{"alertname": "Noisy", "severity": "info"},
+	}
+	info.ShortID = p.groups.add(info)
+	p.trackEscalation(info)
+
+	if steps := p.dueEscalations(start.Add(5 * time.Minute)); len(steps) != 0 {
+		t.Fatalf("expected nothing to escalate yet, got %v", steps)
+	}
+	steps := p.dueEscalations(start.Add(11 * time.Minute))
+	if len(steps) != 1 || steps[0].dest.User != "alice" {
+		t.Fatalf("expected a DM to alice, got %v", steps)
+	}
+
+	// The state survives a restart.
+	p = newP()
+	steps = p.dueEscalations(start.Add(22 * time.Minute))
+	if len(steps) != 1 || steps[0].dest.User != "bob" {
+		t.Fatalf("expected a DM to bob after a restart, got %v", steps)
+	}
+	steps = p.dueEscalations(start.Add(33 * time.Minute))
+	if len(steps) != 1 || steps[0].dest.Channel != "escalations" {
+		t.Fatalf("expected a post to the escalation channel, got %v", steps)
+	}
+
+	// Repeat notifications do not restart it.
+	p.trackEscalation(page)
+	if steps := p.dueEscalations(start.Add(44 * time.Minute)); len(steps) != 0 {
+		t.Fatalf("expected nothing more once everyone is told, got %v", steps)
+	}
+
+	page.Status = "resolved"
+	p.trackEscalation(page)
+	if _, ok := p.escalatingGroup(page.ShortID); ok {
+		t.Fatalf("expected the escalation to stop when the group resolved")
+	}
+
+	// Acknowledging a group stops its escalation.
+	page.Status = "firing"
+	page.Alerts = alerts{{StartsAt: time.Now()}}
+	p.trackEscalation(page)
+	if _, err := p.ack(page.ShortID, "carol"); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if steps := p.dueEscalations(time.Now().Add(time.Hour)); len(steps) != 0 {
+		t.Fatalf("expected no escalation once acknowledged, got %v", steps)
+	}
+}
@@ -0,0 +1,53 @@
+package prometheus
+
+import (
+	"encoding/json"
+
+	"github.com/tcolgate/hugot"
+)
+
+// kvFields returns a field for each of the names that has a value in
+// kv, in the order given.
+func kvFields(short bool, kv map[string]string, names ...string) []hugot.AttachmentField {
+	fs := []hugot.AttachmentField{}
+	for _, n := range names {
+		v, ok := kv[n]
+		if !ok || v == "" {
+			continue
+		}
+		fs = append(fs, hugot.AttachmentField{Title: n, Value: v, Short: short})
+	}
+	return fs
+}
+
+// shortFields is a template function returning short attachment
+// fields for the given label or annotation names, skipping any that are
+// not set.
+func shortFields(kv KV, names ...string) []hugot.AttachmentField {
+	return kvFields(true, kv, names...)
+}
+
+// longFields is like shortFields, but the fields take the full width
+// of the attachment.
+func longFields(kv KV, names ...string) []hugot.AttachmentField {
+	return kvFields(false, kv, names...)
+}
+
+// fieldsJSON is a template function that renders lists of fields as
+// the JSON expected from the fields_json template. If that is not
+// empty, hugot.AttachmentFromTemplates unmarshals it as a list of
+// hugot.AttachmentField for the attachment's Fields.
+func fieldsJSON(fss ...[]hugot.AttachmentField) (string, error) {
+	all := []hugot.AttachmentField{}
+	for _, fs := range fss {
+		all = append(all, fs...)
+	}
+	if len(all) == 0 {
+		return "", nil
+	}
+	bs, err := json.Marshal(all)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
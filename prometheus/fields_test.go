@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/tcolgate/hugot"
+)
+
+func TestFieldsJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		d      *tmplData
+		exp    []hugot.AttachmentField
+	}{
+		{
+			name: "default",
+			d: &tmplData{
+				CommonLabels: KV{"alertname": "Down", "job": "node", "severity": "page"},
+			},
+			exp: []hugot.AttachmentField{
+				{Title: "severity", Value: "page", Short: true},
+				{Title: "job", Value: "node", Short: true},
+			},
+		},
+		{
+			name:   "annotations",
+			fields: `{{ fieldsJSON (shortFields .CommonLabels "job") (longFields .CommonAnnotations "summary" "missing") }}`,
+			d: &tmplData{
+				CommonLabels:      KV{"job": "node"},
+				CommonAnnotations: KV{"summary": "node is down"},
+			},
+			exp: []hugot.AttachmentField{
+				{Title: "job", Value: "node", Short: true},
+				{Title: "summary", Value: "node is down", Short: false},
+			},
+		},
+		{
+			name: "no fields",
+			d:    &tmplData{CommonLabels: KV{"alertname": "Down"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tmpls := template.New("test").Funcs(TemplateFuncs)
+		if tt.fields != "" {
+			template.Must(tmpls.New("fields_json").Parse(tt.fields))
+		}
+		tmpls = defaultTmpls(tmpls)
+
+		atch, err := hugot.AttachmentFromTemplates(tmpls, tt.d)
+		if err != nil {
+			t.Errorf("%s: unexpected error, %v", tt.name, err)
+			continue
+		}
+		if len(tt.exp) == 0 {
+			if len(atch.Fields) != 0 {
+				t.Errorf("%s: expected no fields, got %v", tt.name, atch.Fields)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(atch.Fields, tt.exp) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.exp, atch.Fields)
+		}
+	}
+}
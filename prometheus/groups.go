@@ -0,0 +1,206 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/handlers/command"
+)
+
+// maxRecentGroups is how many recently notified alert groups are
+// remembered for silence-group.
+const maxRecentGroups = 200
+
+// recentGroup is an alert group we have recently told users about.
+type recentGroup struct {
+	Receiver    string
+	GroupLabels KV
+	Exprs       []string
+	StartsAt    time.Time
+	Seen        time.Time
+}
+
+// recentGroups hands out short IDs for alert groups, and remembers
+// the most recently used ones so that they can be referred to later.
+type recentGroups struct {
+	sync.Mutex
+	max    int
+	order  []string
+	groups map[string]recentGroup
+}
+
+func newRecentGroups(max int) *recentGroups {
+	return &recentGroups{
+		max:    max,
+		groups: map[string]recentGroup{},
+	}
+}
+
+// groupID returns a short, stable, ID for the group with the given
+// receiver and group labels.
+func groupID(recv string, groupLabels KV) string {
+	h := sha1.New()
+	io.WriteString(h, recv)
+	for _, p := range groupLabels.SortedPairs() {
+		io.WriteString(h, "\xff"+p.Name+"\xff"+p.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:6]
+}
+
+// add records the group and returns its short ID.
+func (rg *recentGroups) add(d *tmplData) string {
+	id := groupID(d.Receiver, d.GroupLabels)
+
+	g := recentGroup{
+		Receiver:    d.Receiver,
+		GroupLabels: d.GroupLabels.clone(),
+		Seen:        time.Now(),
+	}
+	seen := map[string]bool{}
+	for i := range d.Alerts {
+		a := &d.Alerts[i]
+		if g.StartsAt.IsZero() || a.StartsAt.Before(g.StartsAt) {
+			g.StartsAt = a.StartsAt
+		}
+		if expr := a.Expr(); expr != "" && !seen[expr] {
+			seen[expr] = true
+			g.Exprs = append(g.Exprs, expr)
+		}
+	}
+
+	rg.Lock()
+	defer rg.Unlock()
+
+	if _, ok := rg.groups[id]; ok {
+		for i := range rg.order {
+			if rg.order[i] == id {
+				rg.order = append(rg.order[:i], rg.order[i+1:]...)
+				break
+			}
+		}
+	}
+	rg.order = append(rg.order, id)
+	rg.groups[id] = g
+
+	for len(rg.order) > rg.max {
+		delete(rg.groups, rg.order[0])
+		rg.order = rg.order[1:]
+	}
+
+	return id
+}
+
+// get returns the group with the given short ID.
+func (rg *recentGroups) get(id string) (recentGroup, bool) {
+	rg.Lock()
+	defer rg.Unlock()
+	g, ok := rg.groups[id]
+	return g, ok
+}
+
+func (p *promH) silenceGroupCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "silence-group",
+		Short:   "silence an alert group from a recent notification",
+		Example: "prometheus silence-group 3fa9c1 1h",
+	}
+
+	comment := cmd.Flags().StringP("comment", "c", "", "why the alerts are being silenced")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("you need to give a group ID, and optionally a duration")
+		}
+
+		dur := 1 * time.Hour
+		if len(args) == 2 {
+			var err error
+			if dur, err = time.ParseDuration(args[1]); err != nil {
+				return fmt.Errorf("bad duration %q, %w", args[1], err)
+			}
+			if dur <= 0 {
+				return fmt.Errorf("the duration must be positive")
+			}
+		}
+
+		g, ok := p.groups.get(args[0])
+		if !ok {
+			return fmt.Errorf("unknown alert group %q, it may be too old", args[0])
+		}
+		if len(g.GroupLabels) == 0 {
+			return fmt.Errorf("alert group %q has no group labels to silence", args[0])
+		}
+
+		ms := groupMatchers(g.GroupLabels)
+
+		c := *comment
+		if c == "" {
+			c = fmt.Sprintf("silenced alert group %s from chat", args[0])
+		}
+
+		id, err := p.createSilence(ctx, ms, m.From, c, dur)
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Created silence %s for %s, expires in %s", id, strings.Join(g.GroupLabels.Values(), " "), dur)
+		if u := p.silenceURL(id); u != "" {
+			msg += fmt.Sprintf(" (%s)", u)
+		}
+		fmt.Fprint(w, msg)
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
+
+// groupMatchers returns equality matchers for each of the group labels.
+func groupMatchers(groupLabels KV) modelv2.Matchers {
+	ms := modelv2.Matchers{}
+	for _, p := range groupLabels.SortedPairs() {
+		name, value, isRegex := p.Name, p.Value, false
+		ms = append(ms, &modelv2.Matcher{
+			Name:    &name,
+			Value:   &value,
+			IsRegex: &isRegex,
+		})
+	}
+	return ms
+}
+
+func (p *promH) graphGroupCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "graph-group",
+		Short:   "graph the expressions of an alert group from a recent notification",
+		Example: "prometheus graph-group 3fa9c1",
+	}
+
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("you need to give a group ID")
+		}
+
+		g, ok := p.groups.get(args[0])
+		if !ok {
+			return fmt.Errorf("unknown alert group %q, it may be too old", args[0])
+		}
+
+		gm := p.groupGraphs(g)
+		if gm == nil {
+			return fmt.Errorf("alert group %q has no expression to graph", args[0])
+		}
+
+		gm.Channel = m.Channel
+		w.Send(ctx, gm)
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
@@ -0,0 +1,35 @@
+package prometheus
+
+import (
+	"testing"
+)
+
+func TestRecentGroups(t *testing.T) {
+	rg := newRecentGroups(2)
+
+	group := func(recv, name string) *tmplData {
+		return &tmplData{
+			Receiver:    recv,
+			GroupLabels: KV{"alertname": name},
+			Alerts: alerts{
+				{GeneratorURL: "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0"},
+			},
+		}
+	}
+
+	a := rg.add(group("team", "A"))
+	if a2 := rg.add(group("team", "A")); a2 != a {
+		t.Fatalf("expected stable ID %s, got %s", a, a2)
+	}
+	if g, _ := rg.get(a); len(g.Exprs) != 1 || g.Exprs[0] != "up == 0" {
+		t.Fatalf("expected the alert expression to be kept, got %v", g.Exprs)
+	}
+	if b := rg.add(group("other", "A")); b == a {
+		t.Fatalf("expected different receivers to get different IDs")
+	}
+	rg.add(group("team", "C"))
+
+	if _, ok := rg.get(a); ok {
+		t.Fatalf("expected oldest group to be evicted")
+	}
+}
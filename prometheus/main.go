@@ -1,9 +1,13 @@
 package prometheus
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig"
 	amC "github.com/prometheus/alertmanager/api/v2/client"
@@ -19,22 +23,68 @@ func init() {
 type promH struct {
 	*command.Handler
 	wh   hugot.WebHookHandler
+	bg   hugot.BackgroundHandler
 	hmux *http.ServeMux
 
 	client   promC.Client
 	amclient *amC.Alertmanager
-	tmpls    *template.Template
+	tmpls    atomic.Value // *template.Template
+	groups   *recentGroups
+	threads  *threads
+	limiter  *limiter
+	batcher  *batcher
+	acks     *acks
+	escs     *escalations
+	tmplSets templateSets
+	tmplErr  templateError
+
+	actionMu   sync.RWMutex
+	actionAuth ActionAuth
+
+	urlMu       sync.RWMutex
+	externalURL string
+	urlIsSet    bool
+
+	authMu sync.RWMutex
+	auth   WebhookAuth
 }
 
 var defTmpls = map[string]string{
 	"channel":     `alerts`,
+	"channels":    `{{ template "channel" . }}`,
 	"color":       `{{ if eq .Status "firing" }}#ff0000{{ else }}#00ff00{{ end }}`,
 	"title":       `[{{ .Status | upper }}{{ if eq .Status "firing" }}:{{ .Alerts.Firing | len }}{{ end }}] {{ .GroupLabels.SortedPairs.Values | join " " }} {{ if gt (len .CommonLabels) (len .GroupLabels) }}({{ with .CommonLabels.Remove .GroupLabels.Names }}{{ .Values | join " " }}{{ end }}){{ end }}`,
-	"title_link":  `{{ .ExternalURL }}/#/alerts?receiver={{ .Receiver }}`,
+	"title_link":  `{{ with .ExternalURL }}{{ . }}/#/alerts?receiver={{ $.Receiver | urlquery }}{{ end }}`,
 	"image_url":   `{{$caQuery := .CommonAnnotations.image_query}}{{ if $caQuery }}http://localhost:8090/hugot/prometheus/graph/thing.png?e={{ now.Unix}}&q={{$caQuery | urlquery}}&s={{ with $start :=  now | date_modify "-15m" }}{{$start.Unix}}{{end}}{{end}}`,
-	"text":        `{{$caRB := .CommonAnnotations.runbook_url}}{{$caDash := .CommonAnnotations.dashboard_url}}{{ range .Alerts.Firing }}{{ printf "%s" .Annotations.description }}{{if not $caDash}}{{ if .Annotations.dashboard_url }}{{printf " [:thermometer:](%s)"  .Annotations.dashboard_url }}{{end}}{{end}}{{if not $caRB}}{{ if .Annotations.runbook_url }}{{ printf "[:clipboard:](%s)" .Annotations.runbook_url }}{{end}}{{end}}{{ printf "\n"}}{{end}}{{ if eq .Status "firing" }} {{if $caRB }}[:clipboard:]({{ $caRB }}#{{ lower .GroupLabels.alertname }}){{ end }}{{ if $caDash }} [:thermometer:]({{ $caDash }}){{end}}{{end}}`,
+	"text":        `{{$caRB := .CommonAnnotations.runbook_url}}{{$caDash := .CommonAnnotations.dashboard_url}}{{ range .Alerts.Firing }}{{ printf "%s" .Annotations.description }}{{if not $caDash}}{{ if .Annotations.dashboard_url }}{{printf " [:thermometer:](%s)"  .Annotations.dashboard_url }}{{end}}{{end}}{{if not $caRB}}{{ if .Annotations.runbook_url }}{{ printf "[:clipboard:](%s)" .Annotations.runbook_url }}{{end}}{{end}}{{ printf "\n"}}{{end}}{{ if eq .Status "firing" }} {{if $caRB }}[:clipboard:]({{ $caRB }}#{{ lower .GroupLabels.alertname }}){{ end }}{{ if $caDash }} [:thermometer:]({{ $caDash }}){{end}}{{end}}{{ if and (eq .Status "firing") .ShortID }}{{ printf "\nsilence with: prometheus silence-group %s 1h" .ShortID }}{{ end }}{{ with .Ack }}{{ printf "\nacknowledged by %s at %s" .By (.At.Format "15:04 MST") }}{{ end }}`,
 	"fallback":    `[{{ .Status | upper }}{{ if eq .Status "firing" }}:{{ .Alerts.Firing | len }}{{ end }}] {{ .GroupLabels.SortedPairs.Values | join " " }} {{ if gt (len .CommonLabels) (len .GroupLabels) }}({{ with .CommonLabels.Remove .GroupLabels.Names }}{{ .Values | join " " }}{{ end }}){{ end }}`,
-	"fields_json": ``,
+	"fields_json": `{{ fieldsJSON (shortFields .CommonLabels "severity" "instance" "job") }}`,
+	"plain":       ``,
+	"silences": `| ID | Matchers | Created By | Comment | State | Remaining |
+|----|----------|------------|---------|-------|-----------|
+{{ range . }}| {{ if .URL }}[{{ .ShortID }}]({{ .URL }}){{ else }}{{ .ShortID }}{{ end }} | {{ .Matchers | join " " }} | {{ .CreatedBy }} | {{ .Comment }} | {{ .State }} | {{ .Remaining }} |
+{{ end }}`,
+	"summary": `**{{ .Alerts }} alerts in {{ .Groups }} groups**{{ with .ExternalURL }} ([alertmanager]({{ . }}/#/alerts)){{ end }}
+By severity: {{ range $i, $c := .BySeverity }}{{ if $i }}, {{ end }}{{ $c.Name }}: {{ $c.Count }}{{ end }}
+By alertname: {{ range $i, $c := .ByAlertname }}{{ if $i }}, {{ end }}{{ $c.Name }}: {{ $c.Count }}{{ end }}
+Largest groups:
+{{ range .Top }}- {{ .GroupLabels.Values | join " " }}: {{ len .Alerts }}{{ with .ShortID }} ({{ . }}){{ end }}{{ with .Ack }} acked by {{ .By }}{{ end }}
+{{ end }}`,
+	"digest": `**{{ len .Groups }} alert groups updated**{{ with .ExternalURL }} ([alertmanager]({{ . }}/#/alerts)){{ end }}
+{{ range .Groups }}- [{{ .Status | upper }}{{ if eq .Status "firing" }}:{{ .Alerts.Firing | len }}{{ end }}] {{ .GroupLabels.SortedPairs.Values | join " " }}{{ with .CommonAnnotations.summary }}: {{ . }}{{ end }}{{ with .Ack }} (acked by {{ .By }}){{ end }}
+{{ end }}`,
+	"alert": `**{{ .Labels.alertname }}** ({{ .Fingerprint }}) {{ .State }}
+Started: {{ .StartsAt.Format "2006-01-02 15:04:05 MST" }}{{ if not .EndsAt.IsZero }}, ends: {{ .EndsAt.Format "2006-01-02 15:04:05 MST" }}{{ end }}
+{{ with .GeneratorURL }}Source: {{ . }}
+{{ end }}{{ with .Receivers }}Receivers: {{ . | join ", " }}
+{{ end }}{{ with .SilencedBy }}Silenced by: {{ . | join ", " }}
+{{ end }}{{ with .InhibitedBy }}Inhibited by: {{ . | join ", " }}
+{{ end }}Labels:
+{{ range .Labels.SortedPairs }}- {{ .Name }}: {{ .Value }}
+{{ end }}{{ with .Annotations }}Annotations:
+{{ range .SortedPairs }}- {{ .Name }}: {{ .Value }}
+{{ end }}{{ end }}
+`,
 }
 
 // TemplateFuncs
@@ -55,6 +105,12 @@ func init() {
 		"join": func(sep string, s []string) string {
 			return strings.Join(s, sep)
 		},
+		// shortFields, longFields and fieldsJSON build the JSON list
+		// of attachment fields expected from fields_json, e.g.
+		// {{ fieldsJSON (shortFields .CommonLabels "severity" "job") }}
+		"shortFields": shortFields,
+		"longFields":  longFields,
+		"fieldsJSON":  fieldsJSON,
 	}) {
 		TemplateFuncs[k] = v
 	}
@@ -64,29 +120,111 @@ func init() {
 func New(c promC.Client, amc *amC.Alertmanager, tmpls *template.Template) *promH {
 	tmpls = defaultTmpls(tmpls)
 
-	h := &promH{nil, nil, http.NewServeMux(), c, amc, tmpls}
+	h := &promH{
+		hmux:     http.NewServeMux(),
+		client:   c,
+		amclient: amc,
+		groups:   newRecentGroups(maxRecentGroups),
+		threads:  newThreads(),
+		limiter:  newLimiter(),
+		batcher:  newBatcher(),
+		acks:     newAcks(),
+		escs:     newEscalations(),
+
+		actionAuth: ActionAuth{Key: newActionKey()},
+	}
+
+	h.setTemplates(tmpls)
 
 	h.Handler = command.NewFunc(func(root *command.Command) error {
 		root.Use = "prometheus"
 		root.Short = "manage prometheus"
 		h.alertCmd(root)
 		h.silenceCmd(root)
+		h.silenceGroupCmd(root)
+		h.graphGroupCmd(root)
+		h.ackCmd(root)
+		h.templatesCmd(root)
 		h.graphCmd(root, true)
 
 		return nil
 	})
 
 	h.hmux.HandleFunc("/", http.NotFound)
-	h.hmux.HandleFunc("/alerts", h.alertsHook)
-	h.hmux.HandleFunc("/alerts/", h.alertsHook)
+	h.hmux.HandleFunc("/alerts", h.authorized(h.alertsHook))
+	h.hmux.HandleFunc("/alerts/", h.authorized(h.alertsHook))
+	h.hmux.HandleFunc("/actions", h.actionsHook)
 	h.hmux.HandleFunc("/graph", h.graphHook)
 	h.hmux.HandleFunc("/graph/", h.graphHook)
 
 	h.wh = hugot.NewWebHookHandler("prometheus", "", h.webHook)
+	h.bg = hugot.NewBackgroundHandler("prometheus", "alert notification digests", h.background)
 
 	return h
 }
 
+// SetExternalURL sets the URL that users should use to reach the
+// Alertmanager UI. If it is not set, the URL is taken from incoming
+// webhook notifications.
+func (p *promH) SetExternalURL(u string) {
+	p.urlMu.Lock()
+	defer p.urlMu.Unlock()
+	p.externalURL = strings.TrimRight(u, "/")
+	p.urlIsSet = true
+}
+
+// learnExternalURL records the URL Alertmanager reported in a webhook
+// notification, unless one has been set explicitly, and returns the URL
+// that should be used.
+func (p *promH) learnExternalURL(u string) string {
+	p.urlMu.Lock()
+	defer p.urlMu.Unlock()
+	if !p.urlIsSet && u != "" {
+		p.externalURL = strings.TrimRight(u, "/")
+	}
+	return p.externalURL
+}
+
+// getExternalURL returns the URL of the Alertmanager UI, or an empty
+// string if it is not yet known.
+func (p *promH) getExternalURL() string {
+	p.urlMu.RLock()
+	defer p.urlMu.RUnlock()
+	return p.externalURL
+}
+
+// background sends the periodic notification digests, resends and
+// escalates unacknowledged notifications, until the context is
+// cancelled, at which point any pending digests are sent.
+func (p *promH) background(ctx context.Context, w hugot.ResponseWriter) {
+	suppressed := time.NewTimer(p.limiter.digestInterval())
+	defer suppressed.Stop()
+	batches := time.NewTimer(p.batcher.digestInterval())
+	defer batches.Stop()
+	unacked := time.NewTicker(ackCheckInterval)
+	defer unacked.Stop()
+
+	for {
+		select {
+		case <-suppressed.C:
+			p.sendSuppressed(ctx, w)
+			suppressed.Reset(p.limiter.digestInterval())
+		case <-batches.C:
+			p.sendBatches(ctx, w)
+			batches.Reset(p.batcher.digestInterval())
+		case <-unacked.C:
+			p.sendRenotify(ctx, w)
+			p.sendEscalations(ctx, w)
+		case <-ctx.Done():
+			fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			p.sendBatches(fctx, w)
+			p.sendSuppressed(fctx, w)
+			cancel()
+			return
+		}
+	}
+}
+
 func defaultTmpls(tmpls *template.Template) *template.Template {
 	if tmpls == nil {
 		tmpls = template.New("defaultTmpls").Funcs(TemplateFuncs)
@@ -100,8 +238,11 @@ func defaultTmpls(tmpls *template.Template) *template.Template {
 	return tmpls
 }
 
-func Register(c promC.Client, amc *amC.Alertmanager, tmpls *template.Template) {
+// Register a new prometheus handler with the default bot.
+func Register(c promC.Client, amc *amC.Alertmanager, tmpls *template.Template) *promH {
 	h := New(c, amc, tmpls)
 	bot.Command(h.Handler)
 	bot.HandleHTTP(h.wh)
+	bot.Background(h.bg)
+	return h
 }
@@ -0,0 +1,66 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+)
+
+// maxPayloadSize limits the size of webhook payloads we will read.
+const maxPayloadSize = 10 << 20
+
+// payloadDecoder decodes one version of the Alertmanager webhook payload
+// into the message passed on to the templates. Supporting a new payload
+// version means adding a decoder that converts it to a webhook.Message.
+type payloadDecoder func(raw []byte) (*webhook.Message, error)
+
+var payloadDecoders = map[string]payloadDecoder{
+	"4": decodePayloadV4,
+}
+
+// decodePayload reads a webhook payload, checks its version and decodes
+// it with the matching decoder.
+func decodePayload(r io.Reader) (*webhook.Message, error) {
+	raw, err := ioutil.ReadAll(io.LimitReader(r, maxPayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook message, %w", err)
+	}
+	if len(raw) > maxPayloadSize {
+		return nil, fmt.Errorf("webhook message is larger than %d bytes", maxPayloadSize)
+	}
+
+	v := struct {
+		Version string `json:"version"`
+	}{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("could not decode webhook message, %w", err)
+	}
+	if v.Version == "" {
+		return nil, fmt.Errorf("webhook message has no version")
+	}
+
+	dec, ok := payloadDecoders[v.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported webhook message version %q", v.Version)
+	}
+
+	hm, err := dec(raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode version %s webhook message, %w", v.Version, err)
+	}
+	if hm.Data == nil {
+		return nil, fmt.Errorf("webhook message contained no alert data")
+	}
+	return hm, nil
+}
+
+func decodePayloadV4(raw []byte) (*webhook.Message, error) {
+	hm := &webhook.Message{}
+	if err := json.Unmarshal(raw, hm); err != nil {
+		return nil, err
+	}
+	return hm, nil
+}
@@ -9,6 +9,7 @@ import (
 	"image/png"
 	"math"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -41,20 +42,12 @@ func (p *promH) graphCmd(root *command.Command, defGraph bool) {
 		e := time.Now()
 
 		if !*text {
-			nu := *p.wh.URL()
-			nu.Path = nu.Path + "graph/thing.png"
-			qs := nu.Query()
-			qs.Set("q", q)
-			qs.Set("s", fmt.Sprintf("%d", s.Unix()))
-			qs.Set("e", fmt.Sprintf("%d", e.Unix()))
-			nu.RawQuery = qs.Encode()
-
 			m := hugot.Message{
 				Channel: m.Channel,
 				Attachments: []hugot.Attachment{
 					{
 						Fallback: "fallback",
-						ImageURL: nu.String(),
+						ImageURL: p.graphURL(q, s, e),
 					},
 				},
 			}
@@ -98,6 +91,35 @@ func (p *promH) graphCmd(root *command.Command, defGraph bool) {
 	root.AddCommand(cmd)
 }
 
+// graphURL returns a link to a PNG graph of the query, rendered by
+// graphHook.
+func (p *promH) graphURL(q string, s, e time.Time) string {
+	return graphURLFrom(*p.wh.URL(), q, s, e)
+}
+
+// graphURLFrom returns a link to a graph of the query, relative to the
+// handler's base URL.
+func graphURLFrom(nu url.URL, q string, s, e time.Time) string {
+	nu.Path = nu.Path + "graph/thing.png"
+	qs := nu.Query()
+	qs.Set("q", q)
+	qs.Set("s", fmt.Sprintf("%d", s.Unix()))
+	qs.Set("e", fmt.Sprintf("%d", e.Unix()))
+	nu.RawQuery = qs.Encode()
+	return nu.String()
+}
+
+// graphStep returns the query resolution for a graph of the given
+// range. Prometheus limits the number of points per series, there's no
+// point asking for more than we can plot anyway.
+func graphStep(start, end time.Time) time.Duration {
+	step := end.Sub(start) / width
+	if step < time.Second {
+		step = time.Second
+	}
+	return step
+}
+
 func maxMin(ss []model.SamplePair) (float64, float64) {
 	max := math.Inf(-1)
 	min := math.Inf(1)
@@ -169,11 +191,13 @@ func (p *promH) graphHook(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	start, end := time.Unix(int64(st), 0), time.Unix(int64(et), 0)
+
 	qapi := prom.NewAPI(p.client)
 	d, _, err := qapi.QueryRange(ctx, q[0], prom.Range{
-		Start: time.Unix(int64(st), 0),
-		End:   time.Unix(int64(et), 0),
-		Step:  1 * time.Second,
+		Start: start,
+		End:   end,
+		Step:  graphStep(start, end),
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -0,0 +1,58 @@
+package prometheus
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAlertExpr(t *testing.T) {
+	tests := []struct {
+		url string
+		exp string
+	}{
+		{url: "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0&g0.tab=1", exp: "up == 0"},
+		{url: "http://prometheus:9090/graph?g1.expr=up", exp: ""},
+		{url: "http://prometheus:9090/graph", exp: ""},
+		{url: "", exp: ""},
+		{url: "http://prometheus:9090/graph?g0.expr=%zz", exp: ""},
+		{url: "://bad", exp: ""},
+	}
+	for _, tt := range tests {
+		a := alert{GeneratorURL: tt.url}
+		if got := a.Expr(); got != tt.exp {
+			t.Errorf("%q: expected expr %q, got %q", tt.url, tt.exp, got)
+		}
+	}
+}
+
+func TestGraphURL(t *testing.T) {
+	base, _ := url.Parse("http://bot:8090/hugot/prometheus/")
+	s := time.Unix(1588327200, 0)
+	e := s.Add(time.Hour)
+
+	got, err := url.Parse(graphURLFrom(*base, "up == 0", s, e))
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if got.Path != "/hugot/prometheus/graph/thing.png" {
+		t.Errorf("unexpected path %q", got.Path)
+	}
+	qs := got.Query()
+	if qs.Get("q") != "up == 0" || qs.Get("s") != "1588327200" || qs.Get("e") != "1588330800" {
+		t.Errorf("unexpected query %v", qs)
+	}
+	if base.Path != "/hugot/prometheus/" {
+		t.Errorf("expected the base URL to be left alone, got %q", base.Path)
+	}
+}
+
+func TestGraphStep(t *testing.T) {
+	s := time.Unix(1588327200, 0)
+	if got := graphStep(s, s.Add(time.Minute)); got != time.Second {
+		t.Errorf("expected short ranges to use 1s steps, got %s", got)
+	}
+	if got := graphStep(s, s.Add(800*time.Minute)); got != time.Minute {
+		t.Errorf("expected a step per plotted point, got %s", got)
+	}
+}
@@ -0,0 +1,142 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tcolgate/hugot"
+)
+
+// RateLimits configures how often webhook alert notifications may be
+// posted. The zero value disables all limits.
+type RateLimits struct {
+	// MinRepeatInterval is the minimum time between notifications for
+	// the same alert group at the same destination. Notifications that
+	// change the status of the group are always sent.
+	MinRepeatInterval time.Duration
+	// PerMinute is the most notifications that will be sent to a
+	// destination in any minute. Notifications over the budget are
+	// counted and reported in a digest.
+	PerMinute int
+	// DigestInterval is how often the counts of suppressed notifications
+	// are reported, it defaults to one minute.
+	DigestInterval time.Duration
+}
+
+type lastSent struct {
+	at     time.Time
+	status string
+}
+
+type suppressed struct {
+	dest  destination
+	count int
+}
+
+// limiter tracks the notifications sent to each destination.
+type limiter struct {
+	sync.Mutex
+	limits     RateLimits
+	last       map[string]lastSent
+	sent       map[string][]time.Time
+	suppressed map[string]*suppressed
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		last:       map[string]lastSent{},
+		sent:       map[string][]time.Time{},
+		suppressed: map[string]*suppressed{},
+	}
+}
+
+// SetRateLimits sets the limits on how often webhook alert notifications
+// are posted.
+func (p *promH) SetRateLimits(rl RateLimits) {
+	p.limiter.Lock()
+	defer p.limiter.Unlock()
+	p.limiter.limits = rl
+}
+
+func (l *limiter) digestInterval() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	if l.limits.DigestInterval <= 0 {
+		return time.Minute
+	}
+	return l.limits.DigestInterval
+}
+
+// allow reports whether a notification for the group may be sent to the
+// destination now, and records it if so.
+func (l *limiter) allow(groupKey, status string, dest destination, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	gk := threadKey(groupKey, dest.key())
+	if l.limits.MinRepeatInterval > 0 {
+		last, ok := l.last[gk]
+		if ok && last.status == status && now.Sub(last.at) < l.limits.MinRepeatInterval {
+			return false
+		}
+	}
+
+	dk := dest.key()
+	if l.limits.PerMinute > 0 {
+		ts := l.sent[dk]
+		for len(ts) > 0 && now.Sub(ts[0]) >= time.Minute {
+			ts = ts[1:]
+		}
+		l.sent[dk] = ts
+		if len(ts) >= l.limits.PerMinute {
+			s, ok := l.suppressed[dk]
+			if !ok {
+				s = &suppressed{dest: dest}
+				l.suppressed[dk] = s
+			}
+			s.count++
+			return false
+		}
+		l.sent[dk] = append(ts, now)
+	}
+
+	for k, last := range l.last {
+		if now.Sub(last.at) > maxThreadAge {
+			delete(l.last, k)
+		}
+	}
+	l.last[gk] = lastSent{at: now, status: status}
+
+	return true
+}
+
+// takeSuppressed returns, and resets, the counts of suppressed
+// notifications for each destination.
+func (l *limiter) takeSuppressed() []suppressed {
+	l.Lock()
+	defer l.Unlock()
+
+	ss := []suppressed{}
+	for _, s := range l.suppressed {
+		ss = append(ss, *s)
+	}
+	l.suppressed = map[string]*suppressed{}
+
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].dest.key() < ss[j].dest.key()
+	})
+	return ss
+}
+
+// sendSuppressed posts a digest to each destination that has had
+// notifications suppressed.
+func (p *promH) sendSuppressed(ctx context.Context, w hugot.ResponseWriter) {
+	for _, s := range p.limiter.takeSuppressed() {
+		m := s.dest.message()
+		m.Text = fmt.Sprintf("%d more alert updates suppressed", s.count)
+		w.Send(ctx, m)
+	}
+}
@@ -0,0 +1,41 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	l.limits = RateLimits{MinRepeatInterval: 5 * time.Minute, PerMinute: 2}
+
+	ops := destination{Channel: "ops"}
+	now := time.Now()
+
+	if !l.allow("a", "firing", ops, now) {
+		t.Fatalf("expected first notification to be allowed")
+	}
+	if l.allow("a", "firing", ops, now.Add(time.Second)) {
+		t.Fatalf("expected repeat notification to be suppressed")
+	}
+	if !l.allow("a", "resolved", ops, now.Add(2*time.Second)) {
+		t.Fatalf("expected status change to be allowed")
+	}
+	if l.allow("b", "firing", ops, now.Add(3*time.Second)) {
+		t.Fatalf("expected notification over budget to be suppressed")
+	}
+	if !l.allow("b", "firing", destination{Channel: "dev"}, now.Add(3*time.Second)) {
+		t.Fatalf("expected budget to be per destination")
+	}
+	if !l.allow("b", "firing", ops, now.Add(time.Minute+time.Second)) {
+		t.Fatalf("expected budget to recover after a minute")
+	}
+
+	ss := l.takeSuppressed()
+	if len(ss) != 1 || ss[0].dest != ops || ss[0].count != 1 {
+		t.Fatalf("expected one suppressed notification for ops, got %v", ss)
+	}
+	if ss := l.takeSuppressed(); len(ss) != 0 {
+		t.Fatalf("expected suppressed counts to be reset, got %v", ss)
+	}
+}
@@ -0,0 +1,425 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/client/silence"
+	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/handlers/command"
+)
+
+func (p *promH) silenceCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:   "silences",
+		Short: "manage alertmanager silences",
+	}
+
+	state := cmd.Flags().StringP("state", "s", "", "only show silences in this state (active, pending or expired), defaults to active and pending")
+	filter := cmd.Flags().StringArrayP("filter", "f", nil, "only show silences matching these matchers")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if err := checkSilenceState(*state); err != nil {
+			return err
+		}
+		if _, err := parseMatchers(*filter); err != nil {
+			return err
+		}
+
+		res, err := p.amclient.Silence.GetSilences(&silence.GetSilencesParams{
+			Context: ctx,
+			Filter:  *filter,
+		})
+		if err != nil {
+			return err
+		}
+
+		sds := []silenceData{}
+		for _, s := range res.GetPayload() {
+			sds = append(sds, p.silenceToLocal(s))
+		}
+		sds = filterSilences(sds, *state)
+
+		if len(sds) == 0 {
+			fmt.Fprint(w, "There are no matching silences")
+			return nil
+		}
+
+		sort.Slice(sds, func(i, j int) bool {
+			return sds[i].EndsAt.Before(sds[j].EndsAt)
+		})
+
+		var out bytes.Buffer
+		if err := p.templates().ExecuteTemplate(&out, "silences", sds); err != nil {
+			return fmt.Errorf("error rendering template, %w", err)
+		}
+		fmt.Fprint(w, out.String())
+		return nil
+	}
+
+	p.silenceAddCmd(cmd)
+	p.silenceExpireCmd(cmd)
+
+	root.AddCommand(cmd)
+}
+
+func (p *promH) silenceAddCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "add",
+		Short:   "create a new alertmanager silence",
+		Example: `prometheus silences add alertname=Foo instance=~"web-.*" --duration 2h --comment "deploying"`,
+	}
+
+	dur := cmd.Flags().DurationP("duration", "d", 1*time.Hour, "how long the silence should last")
+	comment := cmd.Flags().StringP("comment", "c", "", "why the alerts are being silenced")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("you need to give at least one matcher")
+		}
+		if *comment == "" {
+			return fmt.Errorf("you need to give a comment")
+		}
+		if *dur <= 0 {
+			return fmt.Errorf("the duration must be positive")
+		}
+
+		ms, err := parseMatchers(args)
+		if err != nil {
+			return err
+		}
+
+		id, err := p.createSilence(ctx, ms, m.From, *comment, *dur)
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Created silence %s, expires in %s", id, *dur)
+		if u := p.silenceURL(id); u != "" {
+			msg += fmt.Sprintf(" (%s)", u)
+		}
+		fmt.Fprint(w, msg)
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
+
+func (p *promH) silenceExpireCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:     "expire",
+		Short:   "expire alertmanager silences by ID or short ID, or by matchers",
+		Example: "prometheus silences expire <id>\nprometheus silences expire --match alertname=Foo",
+	}
+
+	match := cmd.Flags().StringArrayP("match", "m", nil, "expire all current silences matching these matchers")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		msg, err := p.expireSilences(ctx, args, *match)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, msg)
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
+
+// expireSilences expires the silences with the given IDs, or ID
+// prefixes, and all current silences matching the matchers. It returns
+// a report of what was expired, and of any that could not be.
+func (p *promH) expireSilences(ctx context.Context, ids, match []string) (string, error) {
+	if len(ids) == 0 && len(match) == 0 {
+		return "", fmt.Errorf("you need to give silence IDs, or --match")
+	}
+
+	ids = append([]string{}, ids...)
+	if len(match) != 0 {
+		if _, err := parseMatchers(match); err != nil {
+			return "", err
+		}
+		res, err := p.amclient.Silence.GetSilences(&silence.GetSilencesParams{
+			Context: ctx,
+			Filter:  match,
+		})
+		if err != nil {
+			return "", err
+		}
+		for _, s := range res.GetPayload() {
+			if s.ID == nil || s.Status == nil || s.Status.State == nil {
+				continue
+			}
+			if *s.Status.State == modelv2.SilenceStatusStateExpired {
+				continue
+			}
+			ids = append(ids, *s.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return "No current silences matched", nil
+	}
+
+	expired := []string{}
+	var errs []string
+	for _, id := range ids {
+		full, err := p.resolveSilenceID(ctx, id)
+		if err == nil {
+			err = p.expireSilence(ctx, full)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		expired = append(expired, full)
+	}
+
+	msg := ""
+	if len(expired) != 0 {
+		msg = fmt.Sprintf("Expired silences:\n%s", strings.Join(expired, "\n"))
+	}
+	if len(errs) != 0 {
+		if msg != "" {
+			msg += "\n"
+		}
+		msg += fmt.Sprintf("Failed to expire silences:\n%s", strings.Join(errs, "\n"))
+	}
+	return msg, nil
+}
+
+// resolveSilenceID returns the full ID of a silence given its ID, or a
+// prefix of it such as the short ID shown in silence listings. The
+// prefix must match exactly one silence.
+func (p *promH) resolveSilenceID(ctx context.Context, id string) (string, error) {
+	if strfmt.IsUUID(id) {
+		return id, nil
+	}
+
+	res, err := p.amclient.Silence.GetSilences(&silence.GetSilencesParams{
+		Context: ctx,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	matches := []string{}
+	for _, s := range res.GetPayload() {
+		if s.ID != nil && strings.HasPrefix(*s.ID, id) {
+			matches = append(matches, *s.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no silence has an ID starting with %q", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%q matches %d silences, give more of the ID", id, len(matches))
+	}
+}
+
+// expireSilence expires the silence with the given ID.
+func (p *promH) expireSilence(ctx context.Context, id string) error {
+	if !strfmt.IsUUID(id) {
+		return fmt.Errorf("%q is not a valid silence ID", id)
+	}
+	_, err := p.amclient.Silence.DeleteSilence(&silence.DeleteSilenceParams{
+		Context:   ctx,
+		SilenceID: strfmt.UUID(id),
+	})
+	return err
+}
+
+// checkSilenceState checks a silence state given to --state.
+func checkSilenceState(state string) error {
+	switch state {
+	case "",
+		modelv2.SilenceStatusStateActive,
+		modelv2.SilenceStatusStatePending,
+		modelv2.SilenceStatusStateExpired:
+		return nil
+	default:
+		return fmt.Errorf("unknown silence state %q, use active, pending or expired", state)
+	}
+}
+
+// filterSilences returns the silences in the given state. With no
+// state, expired silences are left out.
+func filterSilences(sds []silenceData, state string) []silenceData {
+	res := []silenceData{}
+	for _, sd := range sds {
+		switch {
+		case state == "" && sd.State == modelv2.SilenceStatusStateExpired:
+			continue
+		case state != "" && sd.State != state:
+			continue
+		}
+		res = append(res, sd)
+	}
+	return res
+}
+
+// createSilence posts a new silence, starting now, and returns its ID.
+func (p *promH) createSilence(ctx context.Context, ms modelv2.Matchers, createdBy, comment string, dur time.Duration) (string, error) {
+	start := strfmt.DateTime(time.Now())
+	end := strfmt.DateTime(time.Now().Add(dur))
+
+	s := &modelv2.PostableSilence{
+		Silence: modelv2.Silence{
+			Matchers:  ms,
+			StartsAt:  &start,
+			EndsAt:    &end,
+			CreatedBy: &createdBy,
+			Comment:   &comment,
+		},
+	}
+
+	res, err := p.amclient.Silence.PostSilences(&silence.PostSilencesParams{
+		Context: ctx,
+		Silence: s,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create silence, %w", err)
+	}
+
+	return res.Payload.SilenceID, nil
+}
+
+// silenceURL returns a link to the given silence in the Alertmanager UI,
+// or an empty string if the Alertmanager URL is not known.
+func (p *promH) silenceURL(id string) string {
+	u := p.getExternalURL()
+	if u == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/#/silences/%s", u, id)
+}
+
+// silenceData holds one silence for the silences template.
+type silenceData struct {
+	ID        string
+	URL       string
+	Matchers  []string
+	CreatedBy string
+	Comment   string
+	State     string
+	StartsAt  time.Time
+	EndsAt    time.Time
+}
+
+// ShortID returns a prefix of the silence ID, which is usually enough
+// to identify it.
+func (s silenceData) ShortID() string {
+	if len(s.ID) > 8 {
+		return s.ID[:8]
+	}
+	return s.ID
+}
+
+// Remaining returns how long is left before the silence expires.
+func (s silenceData) Remaining() time.Duration {
+	d := time.Until(s.EndsAt).Round(time.Minute)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (p *promH) silenceToLocal(s *modelv2.GettableSilence) silenceData {
+	sd := silenceData{}
+	if s.ID != nil {
+		sd.ID = *s.ID
+		sd.URL = p.silenceURL(sd.ID)
+	}
+	if s.Status != nil && s.Status.State != nil {
+		sd.State = *s.Status.State
+	}
+	if s.CreatedBy != nil {
+		sd.CreatedBy = *s.CreatedBy
+	}
+	if s.Comment != nil {
+		sd.Comment = *s.Comment
+	}
+	if s.StartsAt != nil {
+		sd.StartsAt = time.Time(*s.StartsAt)
+	}
+	if s.EndsAt != nil {
+		sd.EndsAt = time.Time(*s.EndsAt)
+	}
+	for _, m := range s.Matchers {
+		sd.Matchers = append(sd.Matchers, matcherString(m))
+	}
+	return sd
+}
+
+// matcherString formats a matcher the same way parseMatcher accepts it.
+func matcherString(m *modelv2.Matcher) string {
+	var name, value string
+	if m.Name != nil {
+		name = *m.Name
+	}
+	if m.Value != nil {
+		value = *m.Value
+	}
+	op := "="
+	if m.IsRegex != nil && *m.IsRegex {
+		op = "=~"
+	}
+	return fmt.Sprintf("%s%s%q", name, op, value)
+}
+
+// parseMatchers parses matchers of the form name=value or name=~regex,
+// as used by amtool.
+func parseMatchers(args []string) (modelv2.Matchers, error) {
+	ms := modelv2.Matchers{}
+	for _, arg := range args {
+		m, err := parseMatcher(arg)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func parseMatcher(s string) (*modelv2.Matcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return nil, fmt.Errorf("bad matcher %q, expected name=value or name=~regex", s)
+	}
+
+	name, op := s[:i], s[i:]
+	isRegex := false
+	switch {
+	case strings.HasPrefix(op, "=~"):
+		isRegex = true
+		op = op[2:]
+	case strings.HasPrefix(op, "!="), strings.HasPrefix(op, "!~"):
+		return nil, fmt.Errorf("bad matcher %q, negative matchers are not supported", s)
+	case strings.HasPrefix(op, "="):
+		op = op[1:]
+	default:
+		return nil, fmt.Errorf("bad matcher %q, expected name=value or name=~regex", s)
+	}
+
+	value := strings.Trim(op, `"`)
+	if value == "" {
+		return nil, fmt.Errorf("bad matcher %q, value must not be empty", s)
+	}
+	if isRegex {
+		if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return nil, fmt.Errorf("bad matcher %q, %w", s, err)
+		}
+	}
+
+	return &modelv2.Matcher{
+		Name:    &name,
+		Value:   &value,
+		IsRegex: &isRegex,
+	}, nil
+}
@@ -0,0 +1,311 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	amC "github.com/prometheus/alertmanager/api/v2/client"
+	modelv2 "github.com/prometheus/alertmanager/api/v2/models"
+)
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		value   string
+		isRegex bool
+		err     bool
+	}{
+		{in: "alertname=Foo", name: "alertname", value: "Foo"},
+		{in: `instance=~"web-.*"`, name: "instance", value: "web-.*", isRegex: true},
+		{in: "instance=~web-.*", name: "instance", value: "web-.*", isRegex: true},
+		{in: "job!=node", err: true},
+		{in: "=Foo", err: true},
+		{in: "alertname=", err: true},
+		{in: "alertname", err: true},
+		{in: "alertname!Foo", err: true},
+		{in: "instance=~web-(", err: true},
+	}
+
+	for _, tt := range tests {
+		m, err := parseMatcher(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", tt.in, err)
+			continue
+		}
+		if *m.Name != tt.name || *m.Value != tt.value || *m.IsRegex != tt.isRegex {
+			t.Errorf("%q: expected %s %s %v, got %s %s %v", tt.in, tt.name, tt.value, tt.isRegex, *m.Name, *m.Value, *m.IsRegex)
+		}
+	}
+}
+
+// fakeAlertmanager serves enough of the Alertmanager v2 API to list and
+// expire silences.
+type fakeAlertmanager struct {
+	silences string
+	fail     string
+	gets     int
+	deleted  []string
+}
+
+func newFakeAlertmanager(t *testing.T, silences string) (*fakeAlertmanager, *amC.Alertmanager) {
+	f := &fakeAlertmanager{silences: silences}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v2/silences":
+			f.gets++
+			fmt.Fprint(w, f.silences)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+			id := strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+			if id == f.fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `"failed to expire"`)
+				return
+			}
+			f.deleted = append(f.deleted, id)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	u, _ := url.Parse(ts.URL)
+	return f, amC.NewHTTPClientWithConfig(nil, &amC.TransportConfig{
+		Host:     u.Host,
+		BasePath: "/api/v2",
+		Schemes:  []string{"http"},
+	})
+}
+
+func testSilenceJSON(id, state string) string {
+	return fmt.Sprintf(`{"id":%q,"status":{"state":%q},"matchers":[{"name":"alertname","value":"Foo","isRegex":false}],"createdBy":"bob","comment":"testing","startsAt":"2020-01-01T00:00:00Z","endsAt":"2020-01-01T01:00:00Z","updatedAt":"2020-01-01T00:00:00Z"}`, id, state)
+}
+
+func TestExpireSilences(t *testing.T) {
+	const (
+		first   = "2d3c6a5e-0000-4000-8000-000000000001"
+		second  = "2d3c6a5e-0000-4000-8000-000000000002"
+		expired = "9f1b7c20-0000-4000-8000-000000000003"
+		failing = "5a6b7c8d-0000-4000-8000-000000000004"
+	)
+	silences := "[" + strings.Join([]string{
+		testSilenceJSON(first, "active"),
+		testSilenceJSON(second, "pending"),
+		testSilenceJSON(expired, "expired"),
+		testSilenceJSON(failing, "active"),
+	}, ",") + "]"
+
+	tests := []struct {
+		name    string
+		ids     []string
+		match   []string
+		err     bool
+		gets    int
+		deleted []string
+		msg     []string
+	}{
+		{name: "nothing given", err: true},
+		{name: "bad matcher", match: []string{"alertname!=Foo"}, err: true},
+		{
+			name:    "full id",
+			ids:     []string{first},
+			deleted: []string{first},
+			msg:     []string{"Expired silences:\n" + first},
+		},
+		{
+			name:    "short id",
+			ids:     []string{"9f1b7c20"},
+			gets:    1,
+			deleted: []string{expired},
+			msg:     []string{"Expired silences:\n" + expired},
+		},
+		{
+			name: "ambiguous short id",
+			ids:  []string{"2d3c6a5e"},
+			gets: 1,
+			msg:  []string{"Failed to expire silences:\n2d3c6a5e: \"2d3c6a5e\" matches 2 silences"},
+		},
+		{
+			name: "unknown short id",
+			ids:  []string{"abcdef"},
+			gets: 1,
+			msg:  []string{"abcdef: no silence has an ID starting with \"abcdef\""},
+		},
+		{
+			name:    "match skips expired, reports failures",
+			match:   []string{"alertname=Foo"},
+			gets:    1,
+			deleted: []string{first, second},
+			msg: []string{
+				"Expired silences:\n" + first + "\n" + second + "\n",
+				"Failed to expire silences:\n" + failing + ": ",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		fam, amc := newFakeAlertmanager(t, silences)
+		fam.fail = failing
+		p := &promH{amclient: amc}
+
+		msg, err := p.expireSilences(context.Background(), tt.ids, tt.match)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			if fam.gets != 0 || len(fam.deleted) != 0 {
+				t.Errorf("%s: expected no API calls", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error, %v", tt.name, err)
+			continue
+		}
+		if fam.gets != tt.gets {
+			t.Errorf("%s: expected %d silence lookups, got %d", tt.name, tt.gets, fam.gets)
+		}
+		if !reflect.DeepEqual(fam.deleted, tt.deleted) {
+			t.Errorf("%s: expected %v to be expired, got %v", tt.name, tt.deleted, fam.deleted)
+		}
+		for _, exp := range tt.msg {
+			if !strings.Contains(msg, exp) {
+				t.Errorf("%s: expected %q in %q", tt.name, exp, msg)
+			}
+		}
+	}
+}
+
+func TestSilenceToLocal(t *testing.T) {
+	p := &promH{}
+	p.setTemplates(defaultTmpls(nil))
+	p.SetExternalURL("http://alertmanager:9093/")
+
+	id, state, by, comment := "2d3c6a5e-0000-4000-8000-000000000001", "active", "bob", "deploying"
+	name, value, regex := "instance", `web-".*`, true
+	plain, plainValue, notRegex := "alertname", "Foo", false
+	starts := strfmt.DateTime(time.Now().Add(-time.Hour))
+	ends := strfmt.DateTime(time.Now().Add(2 * time.Hour))
+	ended := strfmt.DateTime(time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name      string
+		s         *modelv2.GettableSilence
+		shortID   string
+		url       string
+		matchers  []string
+		remaining time.Duration
+		row       string
+	}{
+		{
+			name: "active",
+			s: &modelv2.GettableSilence{
+				ID:     &id,
+				Status: &modelv2.SilenceStatus{State: &state},
+				Silence: modelv2.Silence{
+					Matchers: modelv2.Matchers{
+						&modelv2.Matcher{Name: &plain, Value: &plainValue, IsRegex: &notRegex},
+						&modelv2.Matcher{Name: &name, Value: &value, IsRegex: &regex},
+					},
+					CreatedBy: &by,
+					Comment:   &comment,
+					StartsAt:  &starts,
+					EndsAt:    &ends,
+				},
+			},
+			shortID:   "2d3c6a5e",
+			url:       "http://alertmanager:9093/#/silences/" + id,
+			matchers:  []string{`alertname="Foo"`, `instance=~"web-\".*"`},
+			remaining: 2 * time.Hour,
+			row:       `| [2d3c6a5e](http://alertmanager:9093/#/silences/` + id + `) | alertname="Foo" instance=~"web-\".*" | bob | deploying | active | 2h0m0s |`,
+		},
+		{
+			name: "ended",
+			s: &modelv2.GettableSilence{
+				Silence: modelv2.Silence{
+					EndsAt: &ended,
+				},
+			},
+			row: `|  |  |  |  |  | 0s |`,
+		},
+	}
+
+	for _, tt := range tests {
+		sd := p.silenceToLocal(tt.s)
+		if sd.ShortID() != tt.shortID || sd.URL != tt.url {
+			t.Errorf("%s: expected short ID %q and URL %q, got %q and %q", tt.name, tt.shortID, tt.url, sd.ShortID(), sd.URL)
+		}
+		if !reflect.DeepEqual(sd.Matchers, tt.matchers) {
+			t.Errorf("%s: expected matchers %v, got %v", tt.name, tt.matchers, sd.Matchers)
+		}
+		if r := sd.Remaining(); r != tt.remaining {
+			t.Errorf("%s: expected %s remaining, got %s", tt.name, tt.remaining, r)
+		}
+
+		var buf bytes.Buffer
+		if err := p.templates().ExecuteTemplate(&buf, "silences", []silenceData{sd}); err != nil {
+			t.Errorf("%s: unexpected error, %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), "\n"+tt.row+"\n") {
+			t.Errorf("%s: expected row %q, got %q", tt.name, tt.row, buf.String())
+		}
+	}
+}
+
+func TestFilterSilences(t *testing.T) {
+	sds := []silenceData{
+		{ID: "a", State: "active"},
+		{ID: "p", State: "pending"},
+		{ID: "e", State: "expired"},
+	}
+
+	tests := []struct {
+		state string
+		exp   []string
+		err   bool
+	}{
+		{state: "", exp: []string{"a", "p"}},
+		{state: "active", exp: []string{"a"}},
+		{state: "pending", exp: []string{"p"}},
+		{state: "expired", exp: []string{"e"}},
+		{state: "silenced", err: true},
+	}
+
+	for _, tt := range tests {
+		err := checkSilenceState(tt.state)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.state)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error, %v", tt.state, err)
+			continue
+		}
+		ids := []string{}
+		for _, sd := range filterSilences(sds, tt.state) {
+			ids = append(ids, sd.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.exp) {
+			t.Errorf("%q: expected %v, got %v", tt.state, tt.exp, ids)
+		}
+	}
+}
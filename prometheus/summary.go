@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	"sort"
+)
+
+// count is a named counter, used in the alert summary.
+type count struct {
+	Name  string
+	Count int
+}
+
+// counts is a list of counters.
+type counts []count
+
+// summaryData holds the data for the summary template.
+type summaryData struct {
+	Alerts      int
+	Groups      int
+	BySeverity  counts
+	ByAlertname counts
+	Top         []*tmplData
+	ExternalURL string
+}
+
+// summarize counts up the alerts in the given groups, and picks out the
+// top n groups by number of alerts.
+func (p *promH) summarize(ds []*tmplData, n int) *summaryData {
+	sd := &summaryData{
+		Groups:      len(ds),
+		ExternalURL: p.getExternalURL(),
+	}
+
+	bySev := map[string]int{}
+	byName := map[string]int{}
+	for _, d := range ds {
+		sd.Alerts += len(d.Alerts)
+		for _, a := range d.Alerts {
+			sev := a.Labels["severity"]
+			if sev == "" {
+				sev = "none"
+			}
+			bySev[sev]++
+			byName[a.Labels["alertname"]]++
+		}
+	}
+	sd.BySeverity = sortedCounts(bySev)
+	sd.ByAlertname = sortedCounts(byName)
+
+	top := make([]*tmplData, len(ds))
+	copy(top, ds)
+	sort.SliceStable(top, func(i, j int) bool {
+		return len(top[i].Alerts) > len(top[j].Alerts)
+	})
+	if n >= 0 && len(top) > n {
+		top = top[:n]
+	}
+	sd.Top = top
+
+	return sd
+}
+
+// sortedCounts returns the counters largest first, then by name.
+func sortedCounts(m map[string]int) counts {
+	cs := counts{}
+	for k, v := range m {
+		cs = append(cs, count{k, v})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Count != cs[j].Count {
+			return cs[i].Count > cs[j].Count
+		}
+		return cs[i].Name < cs[j].Name
+	})
+	return cs
+}
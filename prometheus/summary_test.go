@@ -0,0 +1,106 @@
+package prometheus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	group := func(name string, sevs ...string) *tmplData {
+		d := &tmplData{GroupLabels: KV{"alertname": name}, ShortID: name}
+		for _, s := range sevs {
+			ls := KV{"alertname": name}
+			if s != "" {
+				ls["severity"] = s
+			}
+			d.Alerts = append(d.Alerts, alert{Labels: ls})
+		}
+		return d
+	}
+	ds := []*tmplData{
+		group("A", "page"),
+		group("B", "info", "info", ""),
+		group("C", "page", "warn", "info"),
+		group("D", "warn"),
+	}
+
+	tests := []struct {
+		name    string
+		top     int
+		expSev  counts
+		expName counts
+		expTop  []string
+	}{
+		{
+			name:    "all",
+			top:     5,
+			expSev:  counts{{"info", 3}, {"page", 2}, {"warn", 2}, {"none", 1}},
+			expName: counts{{"B", 3}, {"C", 3}, {"A", 1}, {"D", 1}},
+			expTop:  []string{"B", "C", "A", "D"},
+		},
+		{
+			name:   "top truncated",
+			top:    2,
+			expTop: []string{"B", "C"},
+		},
+		{
+			name:   "no top",
+			top:    0,
+			expTop: []string{},
+		},
+	}
+
+	p := &promH{}
+	for _, tt := range tests {
+		sd := p.summarize(ds, tt.top)
+		if sd.Alerts != 8 || sd.Groups != 4 {
+			t.Errorf("%s: expected 8 alerts in 4 groups, got %d in %d", tt.name, sd.Alerts, sd.Groups)
+		}
+		if tt.expSev != nil && !reflect.DeepEqual(sd.BySeverity, tt.expSev) {
+			t.Errorf("%s: expected severities %v, got %v", tt.name, tt.expSev, sd.BySeverity)
+		}
+		if tt.expName != nil && !reflect.DeepEqual(sd.ByAlertname, tt.expName) {
+			t.Errorf("%s: expected alertnames %v, got %v", tt.name, tt.expName, sd.ByAlertname)
+		}
+		top := []string{}
+		for _, d := range sd.Top {
+			top = append(top, d.ShortID)
+		}
+		if !reflect.DeepEqual(top, tt.expTop) {
+			t.Errorf("%s: expected top groups %v, got %v", tt.name, tt.expTop, top)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := defaultTmpls(nil).ExecuteTemplate(&buf, "summary", p.summarize(ds, 1)); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	exp := `**8 alerts in 4 groups**
+By severity: info: 3, page: 2, warn: 2, none: 1
+By alertname: B: 3, C: 3, A: 1, D: 1
+Largest groups:
+- B: 3 (B)
+`
+	if buf.String() != exp {
+		t.Errorf("expected summary %q, got %q", exp, buf.String())
+	}
+}
+
+func TestWantSummary(t *testing.T) {
+	tests := []struct {
+		summary, full bool
+		n             int
+		exp           bool
+	}{
+		{n: maxFullGroups, exp: false},
+		{n: maxFullGroups + 1, exp: true},
+		{full: true, n: maxFullGroups + 1, exp: false},
+		{summary: true, n: 1, exp: true},
+	}
+	for _, tt := range tests {
+		if got := wantSummary(tt.summary, tt.full, tt.n); got != tt.exp {
+			t.Errorf("summary=%v full=%v n=%d: expected %v, got %v", tt.summary, tt.full, tt.n, tt.exp, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package prometheus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// MessageIDSender can be implemented by a hugot.ResponseWriter whose
+// adapter can report the IDs of the messages it posts. Along with
+// MessageThreader and MessageUpdater, it is what threading alert
+// notifications needs from a chat connection. None of the hugot
+// adapters, nor hugot's own ResponseWriter, implement these yet, so for
+// now every update is sent as a new message.
+type MessageIDSender interface {
+	// SendWithID sends the message and returns the adapter's ID for it.
+	SendWithID(ctx context.Context, m *hugot.Message) (string, error)
+}
+
+// MessageThreader can be implemented by a hugot.ResponseWriter whose
+// adapter can post replies to earlier messages in a thread.
+type MessageThreader interface {
+	// SendReply sends the message as a threaded reply to the message
+	// with the given ID.
+	SendReply(ctx context.Context, parentID string, m *hugot.Message) (string, error)
+}
+
+// MessageUpdater can be implemented by a hugot.ResponseWriter whose
+// adapter can edit messages that have already been posted.
+type MessageUpdater interface {
+	// UpdateMessage replaces the content of the message with the given
+	// ID.
+	UpdateMessage(ctx context.Context, id string, m *hugot.Message) error
+}
+
+// maxThreadAge is how long we remember the message posted for an alert
+// group.
+const maxThreadAge = 24 * time.Hour
+
+type thread struct {
+	id   string
+	seen time.Time
+}
+
+// threads remembers the first message posted for each alert group
+// key at each destination, so later updates can be attached to it.
+type threads struct {
+	sync.Mutex
+	ts map[string]thread
+
+	// unsupported is used to log, once, that the chat connection
+	// cannot thread notifications.
+	unsupported sync.Once
+}
+
+func newThreads() *threads {
+	return &threads{ts: map[string]thread{}}
+}
+
+func threadKey(groupKey, dest string) string {
+	return groupKey + "\xff" + dest
+}
+
+func (t *threads) get(groupKey, dest string) (string, bool) {
+	t.Lock()
+	defer t.Unlock()
+	th, ok := t.ts[threadKey(groupKey, dest)]
+	if !ok || time.Since(th.seen) > maxThreadAge {
+		return "", false
+	}
+	return th.id, true
+}
+
+func (t *threads) set(groupKey, dest, id string) {
+	t.Lock()
+	defer t.Unlock()
+	now := time.Now()
+	for k, th := range t.ts {
+		if now.Sub(th.seen) > maxThreadAge {
+			delete(t.ts, k)
+		}
+	}
+	t.ts[threadKey(groupKey, dest)] = thread{id: id, seen: now}
+}
+
+func (t *threads) forget(groupKey, dest string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.ts, threadKey(groupKey, dest))
+}
+
+// sendThreaded sends a notification for an alert group. If the
+// ResponseWriter implements MessageIDSender, updates for a group we
+// have already notified about are sent as replies to the first message,
+// and the first message is edited to show the latest state. Once the
+// group resolves, the next notification starts a new thread. Otherwise,
+// which is currently always the case with hugot's adapters, each
+// notification is sent as a new message.
+func (p *promH) sendThreaded(ctx context.Context, rw hugot.ResponseWriter, groupKey, status string, dest destination, m *hugot.Message) {
+	ids, ok := rw.(MessageIDSender)
+	if !ok {
+		p.threads.unsupported.Do(func() {
+			glog.Infof("the chat connection cannot report message IDs, alert group updates will not be threaded")
+		})
+	}
+	if !ok || groupKey == "" {
+		rw.Send(ctx, m)
+		return
+	}
+
+	defer func() {
+		if status == "resolved" {
+			p.threads.forget(groupKey, dest.key())
+		}
+	}()
+
+	parent, ok := p.threads.get(groupKey, dest.key())
+	if !ok {
+		id, err := ids.SendWithID(ctx, m)
+		if err != nil {
+			glog.Errorf("error sending alert notification, %v", err)
+			return
+		}
+		p.threads.set(groupKey, dest.key(), id)
+		return
+	}
+
+	updated := false
+	if mu, ok := rw.(MessageUpdater); ok {
+		if err := mu.UpdateMessage(ctx, parent, m); err != nil {
+			glog.Errorf("error updating alert notification, %v", err)
+		} else {
+			updated = true
+		}
+	}
+
+	if mt, ok := rw.(MessageThreader); ok {
+		if _, err := mt.SendReply(ctx, parent, m); err != nil {
+			glog.Errorf("error sending alert notification reply, %v", err)
+		}
+		return
+	}
+
+	if !updated {
+		rw.Send(ctx, m)
+	}
+}
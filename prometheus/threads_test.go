@@ -0,0 +1,111 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/tcolgate/hugot"
+)
+
+// fakeWriter records what is sent to it. It supports message IDs,
+// threaded replies and edits.
+type fakeWriter struct {
+	hugot.ResponseWriter
+	n       int
+	sent    []*hugot.Message
+	replies map[string][]*hugot.Message
+	updates map[string][]*hugot.Message
+}
+
+func newFakeWriter() *fakeWriter {
+	return &fakeWriter{
+		replies: map[string][]*hugot.Message{},
+		updates: map[string][]*hugot.Message{},
+	}
+}
+
+func (f *fakeWriter) Send(ctx context.Context, m *hugot.Message) {
+	f.sent = append(f.sent, m)
+}
+
+func (f *fakeWriter) SendWithID(ctx context.Context, m *hugot.Message) (string, error) {
+	f.n++
+	f.sent = append(f.sent, m)
+	return fmt.Sprintf("msg%d", f.n), nil
+}
+
+func (f *fakeWriter) SendReply(ctx context.Context, parentID string, m *hugot.Message) (string, error) {
+	f.n++
+	f.replies[parentID] = append(f.replies[parentID], m)
+	return fmt.Sprintf("msg%d", f.n), nil
+}
+
+func (f *fakeWriter) UpdateMessage(ctx context.Context, id string, m *hugot.Message) error {
+	f.updates[id] = append(f.updates[id], m)
+	return nil
+}
+
+// plainWriter only supports plain sends.
+type plainWriter struct {
+	hugot.ResponseWriter
+	sent []*hugot.Message
+}
+
+func (w *plainWriter) Send(ctx context.Context, m *hugot.Message) {
+	w.sent = append(w.sent, m)
+}
+
+func TestSendThreaded(t *testing.T) {
+	p := newTestHandler()
+	ctx := context.Background()
+	ops := destination{Channel: "ops"}
+	dev := destination{Channel: "dev"}
+
+	w := newFakeWriter()
+	first := &hugot.Message{Text: "firing"}
+	p.sendThreaded(ctx, w, "group", "firing", ops, first)
+	if len(w.sent) != 1 || w.sent[0] != first {
+		t.Fatalf("expected the first notification to be sent, got %v", w.sent)
+	}
+	if id, ok := p.threads.get("group", ops.key()); !ok || id != "msg1" {
+		t.Fatalf("expected the first message to be recorded, got %q %v", id, ok)
+	}
+
+	update := &hugot.Message{Text: "still firing"}
+	p.sendThreaded(ctx, w, "group", "firing", ops, update)
+	if len(w.sent) != 1 {
+		t.Fatalf("expected updates not to start a new message, got %d sent", len(w.sent))
+	}
+	if len(w.replies["msg1"]) != 1 || w.replies["msg1"][0] != update {
+		t.Fatalf("expected the update as a reply to msg1, got %v", w.replies)
+	}
+	if len(w.updates["msg1"]) != 1 || w.updates["msg1"][0] != update {
+		t.Fatalf("expected msg1 to be edited, got %v", w.updates)
+	}
+
+	p.sendThreaded(ctx, w, "group", "firing", dev, &hugot.Message{Text: "firing"})
+	if len(w.sent) != 2 {
+		t.Fatalf("expected each destination to get its own thread, got %d sent", len(w.sent))
+	}
+
+	p.sendThreaded(ctx, w, "group", "resolved", ops, &hugot.Message{Text: "resolved"})
+	if len(w.replies["msg1"]) != 2 {
+		t.Fatalf("expected the resolve as a reply, got %v", w.replies["msg1"])
+	}
+	if _, ok := p.threads.get("group", ops.key()); ok {
+		t.Fatalf("expected the resolve to clear the thread")
+	}
+
+	p.sendThreaded(ctx, w, "group", "firing", ops, &hugot.Message{Text: "firing again"})
+	if len(w.sent) != 3 {
+		t.Fatalf("expected firing again to start a new thread, got %d sent", len(w.sent))
+	}
+
+	pw := &plainWriter{}
+	p.sendThreaded(ctx, pw, "other", "firing", ops, &hugot.Message{Text: "firing"})
+	p.sendThreaded(ctx, pw, "other", "firing", ops, &hugot.Message{Text: "still firing"})
+	if len(pw.sent) != 2 {
+		t.Fatalf("expected plain sends without thread support, got %d", len(pw.sent))
+	}
+}
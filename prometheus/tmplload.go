@@ -0,0 +1,137 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// LoadTemplates reads the *.tmpl files in dir. Each file gives the
+// template named after it, so title.tmpl replaces the default title
+// template. Files may also define extra templates with define. Any
+// templates not given in the directory take their default values.
+func LoadTemplates(dir string) (*template.Template, error) {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(fns)
+
+	tmpls := template.New("loadedTmpls").Funcs(TemplateFuncs)
+	for _, fn := range fns {
+		bs, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		tn := strings.TrimSuffix(filepath.Base(fn), ".tmpl")
+		if _, err := tmpls.New(tn).Parse(string(bs)); err != nil {
+			return nil, fmt.Errorf("could not parse %s, %w", fn, err)
+		}
+	}
+
+	return defaultTmpls(tmpls), nil
+}
+
+// tmplDirState summarises the template files in a directory, so that we
+// can tell when they have changed.
+func tmplDirState(dir string) (string, error) {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(fns)
+
+	var sb strings.Builder
+	for _, fn := range fns {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", fn, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// templateError holds the error from the last attempt to reload
+// templates.
+type templateError struct {
+	sync.Mutex
+	err error
+}
+
+// TemplateError returns the error from the last attempt to reload the
+// templates, or nil if it succeeded.
+func (p *promH) TemplateError() error {
+	p.tmplErr.Lock()
+	defer p.tmplErr.Unlock()
+	return p.tmplErr.err
+}
+
+// ReloadTemplates loads the templates from dir, and replaces the
+// handler's templates with them. If they can't be loaded the current
+// templates are kept.
+func (p *promH) ReloadTemplates(dir string) error {
+	tmpls, err := LoadTemplates(dir)
+	if err == nil {
+		err = p.setTemplates(tmpls)
+	}
+
+	p.tmplErr.Lock()
+	p.tmplErr.err = err
+	p.tmplErr.Unlock()
+
+	if err != nil {
+		glog.Errorf("could not reload templates from %s, keeping the current templates, %v", dir, err)
+		return err
+	}
+	glog.Infof("reloaded templates from %s", dir)
+	return nil
+}
+
+// WatchTemplates reloads the templates from dir whenever the files in it
+// change, or the process receives a SIGHUP, until the context is
+// cancelled. The directory is checked for changes every interval.
+func (p *promH) WatchTemplates(ctx context.Context, dir string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	last, err := tmplDirState(dir)
+	if err != nil {
+		glog.Errorf("could not check templates in %s, %v", dir, err)
+	}
+
+	for {
+		select {
+		case <-hup:
+			p.ReloadTemplates(dir)
+		case <-t.C:
+			st, err := tmplDirState(dir)
+			if err != nil {
+				glog.Errorf("could not check templates in %s, %v", dir, err)
+				continue
+			}
+			if st == last {
+				continue
+			}
+			last = st
+			p.ReloadTemplates(dir)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
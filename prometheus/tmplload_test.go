@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmpls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, body string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("channel.tmpl", `ops`)
+	tmpls, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if tmpls.Lookup("title") == nil {
+		t.Fatalf("expected missing templates to get their defaults")
+	}
+
+	p := &promH{}
+	p.setTemplates(tmpls)
+
+	channel := func() string {
+		var buf bytes.Buffer
+		if err := p.templates().ExecuteTemplate(&buf, "channel", nil); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		return buf.String()
+	}
+
+	write("channel.tmpl", `dev`)
+	if err := p.ReloadTemplates(dir); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if c := channel(); c != "dev" {
+		t.Fatalf("expected reloaded channel dev, got %q", c)
+	}
+
+	write("channel.tmpl", `{{ if }}`)
+	if err := p.ReloadTemplates(dir); err == nil {
+		t.Fatalf("expected an error from a broken template")
+	}
+	if p.TemplateError() == nil {
+		t.Fatalf("expected the reload error to be kept")
+	}
+	if c := channel(); c != "dev" {
+		t.Fatalf("expected the last good templates to be kept, got %q", c)
+	}
+}
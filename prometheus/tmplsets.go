@@ -0,0 +1,157 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/tcolgate/hugot"
+)
+
+// SeverityTemplates are example template sets for use with
+// SetTemplateSets and the severity label. Pages get a red attachment
+// listing the affected instances, with extra fields for the team,
+// summary and impact. Info alerts get a plain one line message. Any
+// template not given in a set comes from the handler's main templates.
+var SeverityTemplates = map[string]map[string]string{
+	"page": {
+		"color":       `{{ if eq .Status "firing" }}#ff0000{{ else }}#00ff00{{ end }}`,
+		"title":       `{{ if eq .Status "firing" }}:rotating_light: {{ end }}[{{ .Status | upper }}{{ if eq .Status "firing" }}:{{ .Alerts.Firing | len }}{{ end }}] {{ .GroupLabels.SortedPairs.Values | join " " }}`,
+		"fields_json": `{{ fieldsJSON (shortFields .CommonLabels "severity" "instance" "job" "team") (longFields .CommonAnnotations "summary" "impact") }}`,
+		"text":        `{{ range .Alerts.Firing }}{{ .Annotations.description }}{{ with .Labels.instance }} ({{ . }}){{ end }}{{ printf "\n" }}{{ end }}{{ with .CommonAnnotations.runbook_url }}[:clipboard: runbook]({{ . }}){{ end }}{{ if and (eq .Status "firing") .ShortID }}{{ printf "\nsilence with: prometheus silence-group %s 1h" .ShortID }}{{ end }}{{ with .Ack }}{{ printf "\nacknowledged by %s at %s" .By (.At.Format "15:04 MST") }}{{ end }}`,
+	},
+	"info": {
+		"plain": `[{{ .Status | upper }}] {{ .GroupLabels.SortedPairs.Values | join " " }}{{ with .CommonAnnotations.summary }}: {{ . }}{{ end }}{{ with .Ack }} (acked by {{ .By }}){{ end }}`,
+	},
+}
+
+// templateSets holds alternative templates, chosen by the value of a
+// label common to all the alerts in a group.
+type templateSets struct {
+	sync.RWMutex
+	label  string
+	sets   map[string]*template.Template
+	merged map[string]*template.Template
+}
+
+// ParseTemplateSets parses template sets, such as SeverityTemplates,
+// for use with SetTemplateSets.
+func ParseTemplateSets(defs map[string]map[string]string) (map[string]*template.Template, error) {
+	sets := map[string]*template.Template{}
+	for v, ts := range defs {
+		set := template.New(v).Funcs(TemplateFuncs)
+		for tn, t := range ts {
+			if _, err := set.New(tn).Parse(t); err != nil {
+				return nil, fmt.Errorf("bad %s template for %s, %w", tn, v, err)
+			}
+		}
+		sets[v] = set
+	}
+	return sets, nil
+}
+
+// SetTemplateSets chooses alternative templates for alert notifications
+// by the value of the given label. If all the alerts in a group share a
+// value for the label, and there is a set for it, that set is used.
+// Templates missing from the set are taken from the handler's main
+// templates.
+func (p *promH) SetTemplateSets(label string, sets map[string]*template.Template) error {
+	p.tmplSets.Lock()
+	defer p.tmplSets.Unlock()
+
+	merged, err := mergeTemplateSets(sets, p.templates())
+	if err != nil {
+		return err
+	}
+
+	p.tmplSets.label = label
+	p.tmplSets.sets = sets
+	p.tmplSets.merged = merged
+	return nil
+}
+
+func mergeTemplateSets(sets map[string]*template.Template, def *template.Template) (map[string]*template.Template, error) {
+	merged := map[string]*template.Template{}
+	for v, set := range sets {
+		m, err := set.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("could not copy %s templates, %w", v, err)
+		}
+		for _, t := range def.Templates() {
+			if t.Tree == nil || m.Lookup(t.Name()) != nil {
+				continue
+			}
+			if _, err := m.AddParseTree(t.Name(), t.Tree); err != nil {
+				return nil, fmt.Errorf("could not add %s template to %s, %w", t.Name(), v, err)
+			}
+		}
+		merged[v] = m
+	}
+	return merged, nil
+}
+
+// templates returns the handler's current main templates.
+func (p *promH) templates() *template.Template {
+	t, _ := p.tmpls.Load().(*template.Template)
+	return t
+}
+
+// setTemplates replaces the handler's main templates, and rebuilds any
+// template sets on top of them.
+func (p *promH) setTemplates(t *template.Template) error {
+	p.tmplSets.Lock()
+	defer p.tmplSets.Unlock()
+
+	if len(p.tmplSets.sets) != 0 {
+		merged, err := mergeTemplateSets(p.tmplSets.sets, t)
+		if err != nil {
+			return err
+		}
+		p.tmplSets.merged = merged
+	}
+
+	p.tmpls.Store(t)
+	return nil
+}
+
+// templatesFor returns the templates to use for an alert group with the
+// given common labels.
+func (p *promH) templatesFor(commonLabels KV) *template.Template {
+	p.tmplSets.RLock()
+	defer p.tmplSets.RUnlock()
+
+	if p.tmplSets.label != "" {
+		if v, ok := commonLabels[p.tmplSets.label]; ok {
+			if t, ok := p.tmplSets.merged[v]; ok {
+				return t
+			}
+		}
+	}
+	return p.templates()
+}
+
+// renderMessage renders an alert notification. If the plain template
+// gives any output, it is sent as a plain text message, otherwise an
+// attachment is built from the templates.
+func renderMessage(tmpls *template.Template, d interface{}) (*hugot.Message, error) {
+	var plain bytes.Buffer
+	if err := tmpls.ExecuteTemplate(&plain, "plain", d); err != nil {
+		return nil, fmt.Errorf("can't expand plain template, %w", err)
+	}
+	if txt := strings.TrimSpace(plain.String()); txt != "" {
+		return &hugot.Message{Text: txt}, nil
+	}
+
+	atch, err := hugot.AttachmentFromTemplates(tmpls, d)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build attachment, %w", err)
+	}
+
+	return &hugot.Message{
+		Attachments: []hugot.Attachment{
+			atch,
+		},
+	}, nil
+}
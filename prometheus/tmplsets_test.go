@@ -0,0 +1,78 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tcolgate/hugot"
+)
+
+func TestTemplateSets(t *testing.T) {
+	p := &promH{}
+	p.setTemplates(defaultTmpls(nil))
+
+	sets, err := ParseTemplateSets(SeverityTemplates)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if err := p.SetTemplateSets("severity", sets); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	if got := p.templatesFor(KV{"severity": "warning"}); got != p.templates() {
+		t.Fatalf("expected the default templates for unknown severity")
+	}
+
+	info := p.templatesFor(KV{"severity": "info"})
+	if info == p.templates() {
+		t.Fatalf("expected the info templates")
+	}
+	if info.Lookup("channel") == nil {
+		t.Fatalf("expected missing templates to come from the defaults")
+	}
+
+	d := &tmplData{
+		Status:      "firing",
+		GroupLabels: KV{"alertname": "DiskFilling"},
+		CommonAnnotations: KV{
+			"summary": "disk is filling up",
+		},
+	}
+	m, err := renderMessage(info, d)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if exp := "[FIRING] DiskFilling: disk is filling up"; m.Text != exp || len(m.Attachments) != 0 {
+		t.Fatalf("expected plain message %q, got %q with %d attachments", exp, m.Text, len(m.Attachments))
+	}
+
+	page := p.templatesFor(KV{"severity": "page"})
+	d = &tmplData{
+		Status:       "firing",
+		GroupLabels:  KV{"alertname": "DiskFull"},
+		CommonLabels: KV{"alertname": "DiskFull", "severity": "page", "team": "storage"},
+		CommonAnnotations: KV{
+			"summary": "disk is full",
+			"impact":  "uploads are failing",
+		},
+	}
+	m, err = renderMessage(page, d)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("expected an attachment for pages, got %#v", m)
+	}
+	if c := m.Attachments[0].Color; c != "#ff0000" {
+		t.Errorf("expected a red attachment, got %q", c)
+	}
+	exp := []hugot.AttachmentField{
+		{Title: "severity", Value: "page", Short: true},
+		{Title: "team", Value: "storage", Short: true},
+		{Title: "summary", Value: "disk is full"},
+		{Title: "impact", Value: "uploads are failing"},
+	}
+	if fs := m.Attachments[0].Fields; !reflect.DeepEqual(fs, exp) {
+		t.Errorf("expected page fields %v, got %v", exp, fs)
+	}
+}
@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/client/alertgroup"
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/handlers/command"
+)
+
+// notificationTmpls are the templates used to build alert
+// notifications, in the order they are shown by templates test.
+var notificationTmpls = []string{
+	"channels",
+	"plain",
+	"color",
+	"title",
+	"title_link",
+	"text",
+	"fallback",
+	"image_url",
+	"fields_json",
+}
+
+func (p *promH) templatesCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:   "templates",
+		Short: "inspect the alert notification templates",
+		Run: func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+			names := []string{}
+			for _, t := range p.templates().Templates() {
+				if t.Tree != nil {
+					names = append(names, t.Name())
+				}
+			}
+			msg := fmt.Sprintf("Templates: %s", strings.Join(names, ", "))
+			if err := p.TemplateError(); err != nil {
+				msg += fmt.Sprintf("\nThe last reload failed, %v", err)
+			}
+			fmt.Fprint(w, msg)
+			return nil
+		},
+	}
+
+	p.templatesTestCmd(cmd)
+
+	root.AddCommand(cmd)
+}
+
+func (p *promH) templatesTestCmd(root *command.Command) {
+	cmd := &command.Command{
+		Use:   "test",
+		Short: "render the notification templates against live alerts, or a webhook sample",
+		Long: `Renders the notification templates, or just the named one, against
+the current alert groups from Alertmanager. With --sample, the templates
+are rendered against the Alertmanager webhook JSON that follows in the
+message instead.`,
+		Example: "prometheus templates test title\nprometheus templates test --sample {\"version\":\"4\", ...}",
+	}
+
+	sample := cmd.Flags().BoolP("sample", "s", false, "render against the webhook JSON given in the rest of the message")
+	limit := cmd.Flags().IntP("limit", "l", 1, "how many alert groups to render")
+	cmd.Run = func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+		names, err := p.testTemplateNames(args)
+		if err != nil {
+			return err
+		}
+
+		var ds []*tmplData
+		if *sample {
+			d, err := sampleData(m.Text)
+			if err != nil {
+				return err
+			}
+			ds = append(ds, d)
+		} else {
+			f, tr := false, true
+			resp, err := p.amclient.Alertgroup.GetAlertGroups(&alertgroup.GetAlertGroupsParams{
+				Context:   ctx,
+				Active:    &tr,
+				Silenced:  &f,
+				Inhibited: &f,
+			})
+			if err != nil {
+				return err
+			}
+			for _, ag := range resp.GetPayload() {
+				if len(ds) >= *limit {
+					break
+				}
+				d := data(p.getExternalURL(), *ag.Receiver.Name, ag.Labels, modelToLocal(ag.Alerts))
+				d.ShortID = groupID(d.Receiver, d.GroupLabels)
+				ds = append(ds, d)
+			}
+			if len(ds) == 0 {
+				fmt.Fprint(w, "There are no outstanding alerts to render the templates against, try --sample")
+				return nil
+			}
+		}
+
+		fmt.Fprint(w, p.renderTemplateTests(names, ds))
+		return nil
+	}
+
+	root.AddCommand(cmd)
+}
+
+// testTemplateNames returns the templates templates test should render,
+// either the one named in the arguments, or all the notification
+// templates.
+func (p *promH) testTemplateNames(args []string) ([]string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "{") {
+		return notificationTmpls, nil
+	}
+	if p.templates().Lookup(args[0]) == nil {
+		return nil, fmt.Errorf("there is no template called %q", args[0])
+	}
+	return args[:1], nil
+}
+
+// sampleData reads the webhook JSON that follows the command in the
+// message text.
+func sampleData(text string) (*tmplData, error) {
+	i := strings.Index(text, "{")
+	if i == -1 {
+		return nil, fmt.Errorf("you need to give the webhook JSON after the command")
+	}
+	js := strings.TrimRight(text[i:], "` \n")
+	hm, err := decodePayload(strings.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	d := hookToLocal(hm.Data)
+	d.ShortID = groupID(d.Receiver, d.GroupLabels)
+	return d, nil
+}
+
+// renderTemplateTests renders the named templates for each group, one
+// code block per group. Failures are shown as name: ERROR, and the
+// fields_json output is parsed and shown as the attachment fields it
+// gives.
+func (p *promH) renderTemplateTests(names []string, ds []*tmplData) string {
+	var out bytes.Buffer
+	for _, d := range ds {
+		tmpls := p.templatesFor(d.CommonLabels)
+
+		out.WriteString("```\n")
+		for _, n := range names {
+			var buf bytes.Buffer
+			if err := tmpls.ExecuteTemplate(&buf, n, d); err != nil {
+				fmt.Fprintf(&out, "%s: ERROR %v\n", n, err)
+				continue
+			}
+			if n != "fields_json" {
+				fmt.Fprintf(&out, "%s: %s\n", n, buf.String())
+				continue
+			}
+
+			js := strings.TrimSpace(buf.String())
+			if js == "" {
+				fmt.Fprintf(&out, "%s: no fields\n", n)
+				continue
+			}
+			var fs []hugot.AttachmentField
+			if err := json.Unmarshal([]byte(js), &fs); err != nil {
+				fmt.Fprintf(&out, "%s: ERROR could not parse %q, %v\n", n, js, err)
+				continue
+			}
+			fmt.Fprintf(&out, "%s:\n", n)
+			for _, f := range fs {
+				short := ""
+				if f.Short {
+					short = " (short)"
+				}
+				fmt.Fprintf(&out, "- %s: %s%s\n", f.Title, f.Value, short)
+			}
+		}
+		out.WriteString("```\n")
+	}
+	return out.String()
+}
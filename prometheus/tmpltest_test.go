@@ -0,0 +1,63 @@
+package prometheus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplatesTest(t *testing.T) {
+	tmpls := template.New("test").Funcs(TemplateFuncs)
+	template.Must(tmpls.New("title").Parse(`{{ .NoSuchField }}`))
+	p := &promH{}
+	p.setTemplates(defaultTmpls(tmpls))
+
+	if names, err := p.testTemplateNames(nil); err != nil || !reflect.DeepEqual(names, notificationTmpls) {
+		t.Errorf("expected all the notification templates, got %v %v", names, err)
+	}
+	if names, err := p.testTemplateNames([]string{"{", "\"version\""}); err != nil || !reflect.DeepEqual(names, notificationTmpls) {
+		t.Errorf("expected sample JSON not to be taken as a name, got %v %v", names, err)
+	}
+	if names, err := p.testTemplateNames([]string{"fallback"}); err != nil || !reflect.DeepEqual(names, []string{"fallback"}) {
+		t.Errorf("expected just the fallback template, got %v %v", names, err)
+	}
+	if _, err := p.testTemplateNames([]string{"nosuch"}); err == nil {
+		t.Errorf("expected an error for an unknown template")
+	}
+
+	for _, bad := range []string{
+		"prometheus templates test --sample",
+		"prometheus templates test --sample {",
+		"prometheus templates test --sample {\"version\":\"5\"}",
+	} {
+		if _, err := sampleData(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	d, err := sampleData("prometheus templates test --sample ```" + testHookBody + "```")
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if d.Receiver != "hugot" || d.ShortID == "" {
+		t.Fatalf("expected the sample group, got %#v", d)
+	}
+
+	out := p.renderTemplateTests([]string{"title", "fallback", "fields_json"}, []*tmplData{d})
+	for _, exp := range []string{
+		"title: ERROR ",
+		"fallback: [FIRING:1] TestAlert (page)\n",
+		"fields_json:\n- severity: page (short)\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected %q in output, got %q", exp, out)
+		}
+	}
+
+	template.Must(p.templates().New("fields_json").Parse(`{ not json`))
+	out = p.renderTemplateTests([]string{"fields_json"}, []*tmplData{d})
+	if !strings.Contains(out, "fields_json: ERROR could not parse") {
+		t.Errorf("expected a parse error for bad fields, got %q", out)
+	}
+}